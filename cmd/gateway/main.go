@@ -2,26 +2,46 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/bruteforce"
+	grpcclients "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients"
 	authclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/auth"
 	charityclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/charity"
 	chatclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/chat"
 	placesclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/places"
 	usersclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/users"
 	votesclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/votes"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/healthcheck"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/auth"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/charity"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/chat"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/health"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/places"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/tokens"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/users"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/handlers/votes"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/cors"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/ratelimit"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/realip"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/upstream"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/kafka"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/notifications"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/tlsreload"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/utils/logger"
 	websocket "github.com/GP-Hacks/kdt2024-gateway/internal/web_socket"
 	proto_auth "github.com/GP-Hacks/proto/pkg/api/auth"
@@ -32,10 +52,12 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -71,9 +93,14 @@ var (
 	)
 )
 
+const mongoDisconnectTimeout = 5 * time.Second
+
 func main() {
-	cfg := config.MustLoad()
-	logger.SetupLogger(true, "http://infrastructure_vector_1:9880")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	logger.SetupLogger(true, cfg.VectorURL)
 
 	log.Info().Msg("=== Gateway starter ===")
 
@@ -81,6 +108,8 @@ func main() {
 	prometheus.MustRegister(httpRequestDuration)
 	prometheus.MustRegister(cpuUsage)
 	prometheus.MustRegister(memoryUsage)
+	prometheus.MustRegister(grpcclients.Metrics()...)
+	prometheus.MustRegister(ratelimit.Metrics()...)
 
 	log.Info().Msg("Prometheus metrics registred")
 
@@ -89,62 +118,190 @@ func main() {
 		os.Exit(1)
 	}
 
-	chatClient, err := setupChatClient(cfg)
+	chatClient, chatConn, err := setupChatClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed setup chat client")
 		os.Exit(1)
 	}
 
-	placesClient, err := setupPlacesClient(cfg)
+	placesClient, placesConn, err := setupPlacesClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed setup places client")
 		os.Exit(1)
 	}
 
-	charityClient, err := setupCharityClient(cfg)
+	charityClient, charityConn, err := setupCharityClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed setup charity client")
 		os.Exit(1)
 	}
 
-	votesClient, err := setupVotesClient(cfg)
+	votesClient, votesConn, err := setupVotesClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed setup votes client")
 		os.Exit(1)
 	}
 
-	authClient, err := setupAuthClient(cfg)
+	authClient, authConn, err := setupAuthClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed setup auth client")
 		os.Exit(1)
 	}
 
-	usersClient, err := setupUsersClient(cfg)
+	usersClient, usersConn, err := setupUsersClient(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed setup users client")
 		os.Exit(1)
 	}
 
-	ks := setupKafka(cfg)
-	log.Info().Msg("Kafka setuped")
-	defer ks.Close()
-
+	// ctx lives until shutdown has drained in-flight requests, so the reply
+	// consumer keeps running while they finish.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := ks.StartResponseConsumer(ctx); err != nil {
-		log.Fatal().Err(err).Msg("Failed start kafka response consumer")
+	authenticator, err := setupAuthenticator(ctx, cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setup jwt authenticator")
+		os.Exit(1)
+	}
+
+	ks := setupChatTransport(cfg)
+	log.Info().Str("transport", cfg.ChatTransport).Msg("Chat transport setuped")
+
+	if err := ks.Start(ctx); err != nil {
+		log.Fatal().Err(err).Msg("Failed start chat transport")
+	}
+
+	notificationsConsumer, err := setupNotifications(ctx, cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setup notifications")
+		os.Exit(1)
+	}
+
+	tickets, err := setupTickets(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setup web socket tickets")
+		os.Exit(1)
 	}
 
-	hub := setupWebSocket()
+	hub, err := setupWebSocket(ctx, cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setup web socket hub")
+		os.Exit(1)
+	}
+	events, err := setupEvents(ctx, cfg, hub)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setup realtime events")
+		os.Exit(1)
+	}
+	corsPolicy := setupCORS(cfg)
+	wsServer := websocket.NewServer(cfg, hub, ks, authenticator, tickets, corsPolicy)
 	log.Info().Msg("Setup web socket hub")
 
-	router := setupRouter(cfg, charityClient, chatClient, placesClient, votesClient, authClient, usersClient, ks, hub)
-	startServer(cfg, router)
+	checker := setupHealthChecks(cfg, ks, map[string]*grpc.ClientConn{
+		"auth":  authConn,
+		"chat":  chatConn,
+		"users": usersConn,
+	}, map[string]healthcheck.CheckFunc{
+		"places":  placesHealthCheck(placesClient),
+		"charity": charityHealthCheck(charityClient),
+		"votes":   votesHealthCheck(votesClient),
+	})
+	checker.Start(ctx)
+
+	limiter, err := setupRateLimiter(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup rate limiter")
+		os.Exit(1)
+	}
+
+	bruteForceStore, challengeVerifier, err := setupBruteForce(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup brute force protection")
+		os.Exit(1)
+	}
+
+	realIP, err := realip.New(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup trusted proxies")
+		os.Exit(1)
+	}
+
+	router := setupRouter(cfg, corsPolicy, realIP, authenticator, limiter, bruteForceStore, challengeVerifier, checker, charityClient, chatClient, placesClient, votesClient, authClient, usersClient, wsServer, tickets)
+	srv, err := startServer(cfg, router)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to start HTTP server")
+		os.Exit(1)
+	}
+	redirectSrv := startRedirectServer(cfg)
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-signalCtx.Done()
+
+	log.Info().Dur("grace_period", cfg.ShutdownTimeout).Msg("Shutting down")
+	checker.SetDraining()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer shutdownCancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Warn().Err(err).Msg("HTTP server did not drain in time")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := wsServer.Shutdown(shutdownCtx); err != nil {
+			log.Warn().Err(err).Msg("Chat requests did not drain in time")
+		}
+	}()
+	if redirectSrv != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := redirectSrv.Shutdown(shutdownCtx); err != nil {
+				log.Warn().Err(err).Msg("Redirect server did not drain in time")
+			}
+		}()
+	}
+	wg.Wait()
+	log.Info().Msg("HTTP and web socket connections drained")
+
+	cancel()
+	closeAll("realtime events", events.Close)
+	if notificationsConsumer != nil {
+		closeAll("notifications consumer", notificationsConsumer.Close)
+	}
+	closeAll("web socket hub", hub.Close)
+	closeAll("chat transport", ks.Close)
+	closeAll("web socket tickets", tickets.Close)
+	closeAll("rate limiter", limiter.Close)
+	closeAll("brute force store", bruteForceStore.Close)
+	closeAll("grpc connections", chatConn.Close, placesConn.Close, charityConn.Close, votesConn.Close, authConn.Close, usersConn.Close)
+	closeAll("mongo db", func() error {
+		// shutdownCtx is usually spent by the drain at this point.
+		ctx, cancel := context.WithTimeout(context.Background(), mongoDisconnectTimeout)
+		defer cancel()
+		return storage.Disconnect(ctx)
+	})
+
+	log.Info().Msg("Server shutdown gracefully")
+}
+
+func closeAll(name string, closers ...func() error) {
+	for _, closeFn := range closers {
+		if err := closeFn(); err != nil {
+			log.Warn().Err(err).Str("resource", name).Msg("Failed to close resource")
+		}
+	}
 }
 
 func connectToMongoDB(cfg *config.Config) error {
-	err := storage.Connect(cfg.MongoDBPath, cfg.MongoDBName, cfg.MongoDBCollection)
+	err := storage.Connect(cfg.MongoDBPath, cfg.MongoDBName, cfg.MongoDBCollection, cfg.DeviceTokenTTL)
 	if err != nil {
 		return err
 	}
@@ -152,67 +309,140 @@ func connectToMongoDB(cfg *config.Config) error {
 	return nil
 }
 
-func setupChatClient(cfg *config.Config) (proto_chat.ChatServiceClient, error) {
-	client, err := chatclient.SetupChatClient(cfg.ChatAddress)
+func setupChatClient(cfg *config.Config) (proto_chat.ChatServiceClient, *grpc.ClientConn, error) {
+	client, conn, err := chatclient.SetupChatClient(cfg.ChatAddress, cfg.ChatGRPC)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Info().Msg("ChatClient setup successfully")
-	return client, nil
+	return client, conn, nil
 }
 
-func setupPlacesClient(cfg *config.Config) (proto.PlacesServiceClient, error) {
-	client, err := placesclient.SetupPlacesClient(cfg.PlacesAddress)
+func setupPlacesClient(cfg *config.Config) (proto.PlacesServiceClient, *grpc.ClientConn, error) {
+	client, conn, err := placesclient.SetupPlacesClient(cfg.PlacesAddress, cfg.PlacesGRPC)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Info().Msg("PlacesClient setup successfully")
-	return client, nil
+	return client, conn, nil
 }
 
-func setupCharityClient(cfg *config.Config) (proto_charity.CharityServiceClient, error) {
-	client, err := charityclient.SetupCharityClient(cfg.CharityAddress)
+func setupCharityClient(cfg *config.Config) (proto_charity.CharityServiceClient, *grpc.ClientConn, error) {
+	client, conn, err := charityclient.SetupCharityClient(cfg.CharityAddress, cfg.CharityGRPC)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Info().Msg("CharityClient setup successfully")
-	return client, nil
+	return client, conn, nil
 }
 
-func setupVotesClient(cfg *config.Config) (proto.VotesServiceClient, error) {
-	client, err := votesclient.SetupVotesClient(cfg.VotesAddress)
+func setupVotesClient(cfg *config.Config) (proto.VotesServiceClient, *grpc.ClientConn, error) {
+	client, conn, err := votesclient.SetupVotesClient(cfg.VotesAddress, cfg.VotesGRPC)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Info().Msg("VotesClient setup successfully")
-	return client, nil
+	return client, conn, nil
 }
 
-func setupAuthClient(cfg *config.Config) (proto_auth.AuthServiceClient, error) {
-	client, err := authclient.SetupAuthClient(cfg.AuthAddress)
+func setupAuthClient(cfg *config.Config) (proto_auth.AuthServiceClient, *grpc.ClientConn, error) {
+	client, conn, err := authclient.SetupAuthClient(cfg.AuthAddress, cfg.AuthGRPC)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Info().Msg("AuthClient setup successfully")
-	return client, nil
+	return client, conn, nil
 }
 
-func setupUsersClient(cfg *config.Config) (proto_users.UserServiceClient, error) {
-	client, err := usersclient.SetupUsersClient(cfg.UsersAddress)
+func setupUsersClient(cfg *config.Config) (proto_users.UserServiceClient, *grpc.ClientConn, error) {
+	client, conn, err := usersclient.SetupUsersClient(cfg.UsersAddress, cfg.UsersGRPC)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	log.Info().Msg("UsersClient setup successfully")
-	return client, nil
+	return client, conn, nil
+}
+
+func setupHealthChecks(cfg *config.Config, transport kafka.ChatTransport, conns map[string]*grpc.ClientConn, rpcChecks map[string]healthcheck.CheckFunc) *healthcheck.Checker {
+	critical := make(map[string]bool, len(cfg.HealthCritical))
+	for _, name := range cfg.HealthCritical {
+		critical[strings.TrimSpace(name)] = true
+	}
+
+	checker := healthcheck.NewChecker(cfg.HealthInterval, cfg.HealthTimeout)
+	for name, conn := range conns {
+		checker.Register(name, critical[name], healthcheck.GRPCConn(conn))
+	}
+	for name, check := range rpcChecks {
+		checker.Register(name, critical[name], check)
+	}
+	checker.Register("mongo", critical["mongo"], storage.Ping)
+	if ks, ok := transport.(*kafka.KafkaService); ok {
+		checker.Register("kafka_producer", critical["kafka_producer"], ks.ProducerHealth)
+		checker.Register("kafka_consumer", critical["kafka_consumer"], ks.ConsumerHealth)
+	}
+	checker.Register("vector", critical["vector"], healthcheck.TCPReachable(cfg.VectorURL))
+
+	return checker
+}
+
+func placesHealthCheck(client proto.PlacesServiceClient) healthcheck.CheckFunc {
+	return func(ctx context.Context) error {
+		resp, err := client.HealthCheck(ctx, &proto.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if !resp.IsHealthy {
+			return fmt.Errorf("places service is not healthy")
+		}
+		return nil
+	}
+}
+
+func charityHealthCheck(client proto_charity.CharityServiceClient) healthcheck.CheckFunc {
+	return func(ctx context.Context) error {
+		resp, err := client.HealthCheck(ctx, &proto_charity.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if !resp.IsHealthy {
+			return fmt.Errorf("charity service is not healthy")
+		}
+		return nil
+	}
+}
+
+func votesHealthCheck(client proto.VotesServiceClient) healthcheck.CheckFunc {
+	return func(ctx context.Context) error {
+		resp, err := client.HealthCheck(ctx, &proto.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if !resp.IsHealthy {
+			return fmt.Errorf("votes service is not healthy")
+		}
+		return nil
+	}
+}
+
+func setupAuthenticator(ctx context.Context, cfg *config.Config) (*jwtauth.Authenticator, error) {
+	authenticator, err := jwtauth.New(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg("JWT authenticator setup successfully")
+	return authenticator, nil
 }
 
-func setupRouter(cfg *config.Config, charityClient proto_charity.CharityServiceClient, chatClient proto_chat.ChatServiceClient, placesClient proto.PlacesServiceClient, votesClient proto.VotesServiceClient, authClient proto_auth.AuthServiceClient, usersClient proto_users.UserServiceClient, ks *kafka.KafkaService, hub *websocket.Hub) *chi.Mux {
+func setupRouter(cfg *config.Config, corsPolicy *cors.Policy, realIP *realip.Resolver, authenticator *jwtauth.Authenticator, limiter *ratelimit.Limiter, bruteForceStore bruteforce.Store, challengeVerifier bruteforce.Verifier, checker *healthcheck.Checker, charityClient proto_charity.CharityServiceClient, chatClient proto_chat.ChatServiceClient, placesClient proto.PlacesServiceClient, votesClient proto.VotesServiceClient, authClient proto_auth.AuthServiceClient, usersClient proto_users.UserServiceClient, wsServer *websocket.Server, tickets *websocket.TicketIssuer) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(realIP.Handler)
 	router.Use(middleware.Recoverer)
+	router.Use(corsPolicy.Handler)
 	router.Use(middleware.URLFormat)
 	router.Use(prometheusMiddleware)
+	router.Use(upstream.Middleware)
 
 	router.Get("/swagger", func(w http.ResponseWriter, r *http.Request) {
 		yamlFile, err := os.ReadFile("/root/open-api.yaml")
@@ -234,62 +464,190 @@ func setupRouter(cfg *config.Config, charityClient proto_charity.CharityServiceC
 	})
 	router.Get("/api/docs/swagger", httpSwagger.Handler(httpSwagger.URL("0.0.0.0:8080/swagger")))
 
-	router.Get("/api/chat/ws", func(w http.ResponseWriter, r *http.Request) {
-		websocket.ServeWS(hub, ks, cfg.ResponseTimeout, w, r)
+	// Route timeouts bound the time spent waiting on upstreams; the remaining
+	// budget is passed on to the gRPC services.
+	short := upstream.Timeout(cfg.RouteTimeoutShort)
+	standard := upstream.Timeout(cfg.RouteTimeout)
+	payment := upstream.Timeout(cfg.RouteTimeoutPayment)
+	upload := upstream.Timeout(cfg.RouteTimeoutUpload)
+
+	// Rate limits are keyed by user on protected routes and by client IP
+	// everywhere else.
+	authLimit := limiter.Limit("auth")
+	paymentLimit := limiter.Limit("payment")
+	chatLimit := limiter.Limit("chat")
+
+	signInGuard := bruteforce.NewGuard(bruteForceStore, "signin:", bruteforce.Policy{
+		Threshold:      cfg.SignInLockoutThreshold,
+		BaseLockout:    cfg.SignInLockoutBase,
+		MaxLockout:     cfg.SignInLockoutMax,
+		Window:         cfg.SignInFailureWindow,
+		ChallengeAfter: cfg.SignInChallengeAfter,
 	})
-	router.Get("/api/chat/history", chat.NewGetHistoryHandler(chatClient))
+	// A fixed lockout as long as the window caps the attempts per window.
+	confirmGuard := bruteforce.NewGuard(bruteForceStore, "confirm:", bruteforce.Policy{
+		Threshold:   cfg.ConfirmMaxAttempts,
+		BaseLockout: cfg.ConfirmWindow,
+		MaxLockout:  cfg.ConfirmWindow,
+		Window:      cfg.ConfirmWindow,
+	})
+
+	router.With(chatLimit).Get("/api/chat/ws", wsServer.ServeWS)
+	router.With(chatLimit).Get("/api/chat/stream", wsServer.ServeSSE)
+
+	router.With(standard).Post("/api/places", places.NewGetPlacesHandler(placesClient))
+	router.With(short).Get("/api/places/categories", places.NewGetCategoriesHandler(placesClient))
+
+	router.With(standard).Get("/api/charity", charity.NewGetCollectionsHandler(charityClient))
+	router.With(short).Get("/api/charity/categories", charity.NewGetCategoriesHandler(charityClient))
+
+	router.With(standard).Get("/api/votes", votes.NewGetVotesHandler(votesClient))
+	router.With(short).Get("/api/votes/categories", votes.NewGetCategoriesHandler(votesClient))
+	router.With(standard, authenticator.OptionalMiddleware).Get("/api/votes/info", votes.NewGetVoteInfoHandler(votesClient))
+
+	router.With(authLimit, standard).Post("/api/auth/sign_up", auth.NewSignUpHandler(authClient))
+	router.With(authLimit, standard).Post("/api/auth/sign_in", auth.NewSignInHandler(authClient, signInGuard, challengeVerifier))
+	router.With(authLimit, standard).Post("/api/auth/refresh_tokens", auth.NewRefreshTokensHandler(authClient))
+	router.With(standard).Post("/api/auth/logout", auth.NewLogoutHandler(authClient))
+	router.With(authLimit, standard).Get("/api/auth/confirm/{token}", auth.NewConfirmEmailPageHandler(authClient, confirmGuard))
+	router.With(authLimit, standard).Post("/api/auth/resend_confirmation_mail", auth.NewResendConfiramtionMailHandler(authClient))
 
-	router.Post("/api/users/token", tokens.NewAddTokenHandler())
+	router.Group(func(r chi.Router) {
+		r.Use(authenticator.Middleware)
 
-	router.Post("/api/places", places.NewGetPlacesHandler(placesClient))
-	router.Get("/api/places/categories", places.NewGetCategoriesHandler(placesClient))
-	router.Get("/api/places/tickets", places.NewGetTicketsHandler(placesClient))
-	router.Post("/api/places/buy", places.NewBuyTicketHandler(placesClient))
+		r.With(standard).Get("/api/chat/history", chat.NewGetHistoryHandler(chatClient))
+		r.With(chatLimit).Post("/api/chat/ws/ticket", chat.NewIssueTicketHandler(tickets))
+		r.With(chatLimit).Post("/api/chat/send", wsServer.SendChat)
 
-	router.Get("/api/charity", charity.NewGetCollectionsHandler(charityClient))
-	router.Get("/api/charity/categories", charity.NewGetCategoriesHandler(charityClient))
-	router.Post("/api/charity/donate", charity.NewDonateHandler(charityClient))
+		r.With(standard).Post("/api/users/token", tokens.NewAddTokenHandler())
+		r.With(standard).Delete("/api/users/token", tokens.NewDeleteTokenHandler())
+		r.With(standard).Get("/api/users/tokens", tokens.NewListTokensHandler())
 
-	router.Get("/api/votes", votes.NewGetVotesHandler(votesClient))
-	router.Get("/api/votes/categories", votes.NewGetCategoriesHandler(votesClient))
-	router.Get("/api/votes/info", votes.NewGetVoteInfoHandler(votesClient))
-	router.Post("/api/votes/rate", votes.NewVoteRateHandler(votesClient))
-	router.Post("/api/votes/petition", votes.NewVotePetitionHandler(votesClient))
-	router.Post("/api/votes/choice", votes.NewVoteChoiceHandler(votesClient))
+		r.With(standard).Get("/api/places/tickets", places.NewGetTicketsHandler(placesClient))
+		r.With(paymentLimit, payment).Post("/api/places/buy", places.NewBuyTicketHandler(placesClient))
 
-	router.Post("/api/auth/sign_up", auth.NewSignUpHandler(authClient))
-	router.Post("/api/auth/sign_in", auth.NewSignInHandler(authClient))
-	router.Post("/api/auth/refresh_tokens", auth.NewRefreshTokensHandler(authClient))
-	router.Post("/api/auth/logout", auth.NewLogoutHandler(authClient))
-	router.Get("/api/auth/confirm/{token}", auth.NewConfirmEmailPageHandler(authClient))
-	router.Post("/api/auth/resend_confirmation_mail", auth.NewResendConfiramtionMailHandler(authClient))
+		r.With(paymentLimit, payment).Post("/api/charity/donate", charity.NewDonateHandler(charityClient))
 
-	router.Get("/api/users/me", users.NewGetMeHandler(usersClient))
-	router.Post("/api/users/update", users.NewUpdateHandler(usersClient))
-	router.Post("/api/users/upload_avatar", users.NewUploadAvatarHandler(usersClient))
+		r.With(standard).Post("/api/votes/rate", votes.NewVoteRateHandler(votesClient))
+		r.With(standard).Post("/api/votes/petition", votes.NewVotePetitionHandler(votesClient))
+		r.With(standard).Post("/api/votes/choice", votes.NewVoteChoiceHandler(votesClient))
+
+		r.With(standard).Get("/api/users/me", users.NewGetMeHandler(usersClient))
+		r.With(standard).Post("/api/users/update", users.NewUpdateHandler(usersClient))
+		r.With(upload).Post("/api/users/upload_avatar", users.NewUploadAvatarHandler(usersClient))
+	})
 
 	router.Handle("/metrics", promhttp.Handler())
+	router.Get("/healthz", health.NewLivenessHandler())
+	router.Get("/readyz", health.NewReadinessHandler(checker))
 
 	log.Info().Msg("Router successfully created with defined routes")
 	return router
 }
 
-func startServer(cfg *config.Config, router *chi.Mux) {
-	srv := http.Server{
+func startServer(cfg *config.Config, router *chi.Mux) (*http.Server, error) {
+	srv := &http.Server{
 		Addr:         cfg.LocalAddress,
 		Handler:      router,
 		WriteTimeout: cfg.Timeout,
 		ReadTimeout:  cfg.Timeout,
 		IdleTimeout:  cfg.IdleTimeout,
+		Protocols:    new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(cfg.HTTP2)
+	srv.Protocols.SetUnencryptedHTTP2(cfg.H2C)
+
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		log.Info().Bool("h2c", cfg.H2C).Msg("Starting HTTP server")
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal().Err(err).Msg("Server encountered an error")
+			}
+		}()
+		return srv, nil
 	}
 
-	log.Info().Msg("Starting HTTP server")
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error().Msg("Server encountered an error")
-		return
+	tlsConfig, err := setupListenerTLS(cfg)
+	if err != nil {
+		return nil, err
 	}
+	srv.TLSConfig = tlsConfig
 
-	log.Info().Msg("Server shutdown gracefully")
+	log.Info().Bool("http2", cfg.HTTP2).Str("min_version", cfg.TLSMinVersion).Msg("Starting HTTPS server")
+	go func() {
+		if err := srv.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Server encountered an error")
+		}
+	}()
+
+	return srv, nil
+}
+
+func setupListenerTLS(cfg *config.Config) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPair, err := tlsreload.NewKeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: keyPair.GetCertificate,
+	}, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q", version)
+}
+
+// startRedirectServer sends plain HTTP clients to the HTTPS listener. It
+// returns nil unless both TLS and a redirect address are configured.
+func startRedirectServer(cfg *config.Config) *http.Server {
+	if cfg.RedirectAddress == "" || cfg.TLSCertFile == "" {
+		return nil
+	}
+
+	_, httpsPort, _ := net.SplitHostPort(cfg.LocalAddress)
+	srv := &http.Server{
+		Addr: cfg.RedirectAddress,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if httpsPort != "" && httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		}),
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	log.Info().Str("address", cfg.RedirectAddress).Msg("Starting HTTP to HTTPS redirect server")
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Redirect server encountered an error")
+		}
+	}()
+
+	return srv
 }
 
 func prometheusMiddleware(next http.Handler) http.Handler {
@@ -329,14 +687,201 @@ func getMemoryUsage() float64 {
 	return vmStat.UsedPercent
 }
 
-func setupWebSocket() *websocket.Hub {
-	hub := websocket.NewHub()
+func setupWebSocket(ctx context.Context, cfg *config.Config) (*websocket.Hub, error) {
+	var fanout websocket.Fanout
+	switch cfg.WSFanoutBackend {
+	case "memory":
+		fanout = websocket.NewMemoryFanout()
+	case "kafka":
+		kafkaFanout, err := websocket.NewKafkaFanout(cfg.KafkaBrokers, cfg.WSFanoutTopic, cfg.InstanceID)
+		if err != nil {
+			return nil, err
+		}
+		fanout = kafkaFanout
+	case "redis":
+		fanout = websocket.NewRedisFanout(newRedisClient(cfg), cfg.WSFanoutChannel)
+	default:
+		return nil, fmt.Errorf("unknown web socket fanout backend %q", cfg.WSFanoutBackend)
+	}
+
+	hub := websocket.NewHub(fanout, cfg.WSSessionBuffer, cfg.WSSessionTTL)
+	if err := hub.Listen(ctx); err != nil {
+		fanout.Close()
+		return nil, fmt.Errorf("failed subscribe web socket fanout: %w", err)
+	}
 	go hub.Run()
 
-	return hub
+	log.Info().Str("backend", cfg.WSFanoutBackend).Msg("Web socket fanout started")
+	return hub, nil
+}
+
+func setupTickets(cfg *config.Config) (*websocket.TicketIssuer, error) {
+	var store websocket.TicketStore
+	switch cfg.WSTicketStore {
+	case "memory":
+		store = websocket.NewMemoryTicketStore()
+	case "redis":
+		store = websocket.NewRedisTicketStore(newRedisClient(cfg), "gateway:wsticket:")
+	default:
+		return nil, fmt.Errorf("unknown web socket ticket store %q", cfg.WSTicketStore)
+	}
+
+	tickets, err := websocket.NewTicketIssuer(cfg.WSTicketSecret, cfg.WSTicketTTL, store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	switch {
+	case cfg.WSTicketSecret == "":
+		log.Warn().Msg("WS_TICKET_SECRET is not set, web socket tickets are valid only on this instance")
+	case cfg.WSTicketStore == "memory":
+		log.Warn().Msg("WS_TICKET_STORE is memory, web socket tickets are single-use only per instance")
+	}
+	return tickets, nil
+}
+
+func setupCORS(cfg *config.Config) *cors.Policy {
+	return cors.New(cors.Options{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	})
+}
+
+func newRedisClient(cfg *config.Config) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddress,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+}
+
+func setupRateLimiter(cfg *config.Config) (*ratelimit.Limiter, error) {
+	var policies []ratelimit.Policy
+	for name, spec := range map[string]string{
+		"auth":    cfg.RateLimitAuth,
+		"payment": cfg.RateLimitPayment,
+		"chat":    cfg.RateLimitChat,
+	} {
+		policy, err := ratelimit.ParsePolicy(name, spec)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	var store ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "redis":
+		store = ratelimit.NewRedisStore(newRedisClient(cfg), "gateway:ratelimit:")
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+
+	log.Info().Str("store", cfg.RateLimitStore).Msg("Rate limiter setup successfully")
+	return ratelimit.New(store, policies...), nil
+}
+
+func setupBruteForce(cfg *config.Config) (bruteforce.Store, bruteforce.Verifier, error) {
+	var store bruteforce.Store
+	switch cfg.BruteForceStore {
+	case "memory":
+		store = bruteforce.NewMemoryStore()
+	case "redis":
+		store = bruteforce.NewRedisStore(newRedisClient(cfg), "gateway:bruteforce:")
+	default:
+		return nil, nil, fmt.Errorf("unknown brute force store %q", cfg.BruteForceStore)
+	}
+
+	var verifier bruteforce.Verifier
+	switch cfg.ChallengeProvider {
+	case "":
+	case "stub":
+		verifier = bruteforce.NewStubVerifier(cfg.ChallengeStubToken)
+	case "siteverify":
+		if cfg.ChallengeVerifyURL == "" || cfg.ChallengeSecret == "" {
+			store.Close()
+			return nil, nil, fmt.Errorf("siteverify challenge requires CHALLENGE_VERIFY_URL and CHALLENGE_SECRET")
+		}
+		verifier = bruteforce.NewSiteVerifier(cfg.ChallengeVerifyURL, cfg.ChallengeSecret)
+	default:
+		store.Close()
+		return nil, nil, fmt.Errorf("unknown challenge provider %q", cfg.ChallengeProvider)
+	}
+
+	log.Info().Str("store", cfg.BruteForceStore).Str("challenge", cfg.ChallengeProvider).Msg("Brute force protection setup successfully")
+	return store, verifier, nil
+}
+
+func setupEvents(ctx context.Context, cfg *config.Config, hub *websocket.Hub) (*websocket.EventSubscriber, error) {
+	events, err := websocket.NewEventSubscriber(cfg.KafkaBrokers, cfg.EventsGroup, cfg.EventsTopic, hub)
+	if err != nil {
+		return nil, err
+	}
+	events.Start(ctx)
+
+	log.Info().Str("topic", cfg.EventsTopic).Msg("Realtime events subscriber started")
+	return events, nil
 }
 
-func setupKafka(config *config.Config) *kafka.KafkaService {
+func setupNotifications(ctx context.Context, cfg *config.Config) (*notifications.Consumer, error) {
+	providers := make(map[string]notifications.Provider)
+	switch cfg.PushProvider {
+	case "":
+		log.Info().Msg("Push notifications disabled")
+		return nil, nil
+	case "stub":
+		stub := notifications.NewStubProvider()
+		providers[storage.PlatformIOS] = stub
+		providers[storage.PlatformAndroid] = stub
+		providers[storage.PlatformWeb] = stub
+		providers[storage.PlatformUnknown] = stub
+	case "native":
+		if cfg.FCMCredentialsFile != "" {
+			fcm, err := notifications.NewFCMProvider(cfg.FCMCredentialsFile)
+			if err != nil {
+				return nil, err
+			}
+			providers[storage.PlatformAndroid] = fcm
+			providers[storage.PlatformWeb] = fcm
+			providers[storage.PlatformUnknown] = fcm
+		}
+		if cfg.APNsKeyFile != "" {
+			apns, err := notifications.NewAPNsProvider(cfg.APNsKeyFile, cfg.APNsKeyID, cfg.APNsTeamID, cfg.APNsTopic, cfg.APNsProduction)
+			if err != nil {
+				return nil, err
+			}
+			providers[storage.PlatformIOS] = apns
+		}
+		if len(providers) == 0 {
+			return nil, fmt.Errorf("native push provider requires FCM or APNs credentials")
+		}
+	default:
+		return nil, fmt.Errorf("unknown push provider %q", cfg.PushProvider)
+	}
+
+	dispatcher := notifications.NewDispatcher(providers)
+	consumer, err := notifications.NewConsumer(cfg.KafkaBrokers, cfg.NotificationsGroup, cfg.NotificationsTopic, dispatcher)
+	if err != nil {
+		return nil, err
+	}
+	consumer.Start(ctx)
+
+	log.Info().Str("provider", cfg.PushProvider).Msg("Notifications consumer started")
+	return consumer, nil
+}
+
+func setupChatTransport(config *config.Config) kafka.ChatTransport {
+	if config.ChatTransport == "memory" {
+		return kafka.NewMemoryTransport(kafka.EchoHandler)
+	}
+
 	kafkaService, err := kafka.NewKafkaService(config)
 	if err != nil {
 		log.Fatal().Msg("Ошибка создания Kafka сервиса: " + err.Error())
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	usersclient "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients/users"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils/logger"
+	proto_users "github.com/GP-Hacks/proto/pkg/api/user"
+	"github.com/rs/zerolog/log"
+)
+
+// One-off migration that converts the old per-user token arrays into per-device
+// documents, re-keying arrays stored under the raw Authorization header to the
+// user ID the header belongs to.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report what would be merged")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	logger.SetupLogger(false, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	authenticator, err := jwtauth.New(ctx, cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed setup jwt authenticator")
+	}
+
+	var usersClient proto_users.UserServiceClient
+	if cfg.UsersAddress != "" {
+		usersClient, _, err = usersclient.SetupUsersClient(cfg.UsersAddress, cfg.UsersGRPC)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed setup users client")
+		}
+	}
+
+	if err := storage.Connect(cfg.MongoDBPath, cfg.MongoDBName, cfg.MongoDBCollection, cfg.DeviceTokenTTL); err != nil {
+		log.Fatal().Err(err).Msg("Failed connect to mongo db")
+	}
+	defer storage.Disconnect(context.Background())
+
+	merged := make(map[string][]string)
+	legacy := make([]string, 0)
+	unresolved := 0
+
+	err = storage.ForEachLegacyDocument(func(owner string, tokens []string) error {
+		userID := owner
+		if isHeaderOwner(owner) {
+			resolved, err := resolveUserID(ctx, authenticator, usersClient, owner)
+			if err != nil {
+				unresolved++
+				log.Warn().Err(err).Int("tokens", len(tokens)).Msg("Failed to resolve legacy token owner")
+				return nil
+			}
+			userID = resolved
+		}
+
+		merged[userID] = append(merged[userID], tokens...)
+		legacy = append(legacy, owner)
+		return nil
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to scan device tokens")
+	}
+
+	log.Info().
+		Int("legacy_documents", len(legacy)).
+		Int("users", len(merged)).
+		Int("unresolved", unresolved).
+		Bool("dry_run", *dryRun).
+		Msg("Device token migration plan")
+
+	if *dryRun {
+		return
+	}
+
+	now := time.Now().UTC()
+	for userID, tokens := range merged {
+		for _, token := range tokens {
+			device := storage.DeviceToken{
+				UserID:     userID,
+				Token:      token,
+				Platform:   storage.PlatformUnknown,
+				LastSeenAt: now,
+			}
+			if err := storage.ImportUserToken(device); err != nil {
+				log.Fatal().Err(err).Str("user_id", userID).Msg("Failed to merge device tokens")
+			}
+		}
+	}
+
+	for _, owner := range legacy {
+		if err := storage.DeleteLegacyDocument(owner); err != nil {
+			log.Fatal().Err(err).Msg("Failed to delete legacy token document")
+		}
+	}
+
+	log.Info().Msg("Device token migration finished")
+}
+
+func isHeaderOwner(owner string) bool {
+	return strings.HasPrefix(owner, "Bearer ") || strings.Count(owner, ".") == 2
+}
+
+func resolveUserID(ctx context.Context, authenticator *jwtauth.Authenticator, usersClient proto_users.UserServiceClient, owner string) (string, error) {
+	token := strings.TrimSpace(strings.TrimPrefix(owner, "Bearer "))
+
+	identity, err := authenticator.AuthenticateExpired(token)
+	if err == nil {
+		return identity.UserID, nil
+	}
+	if usersClient == nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := usersClient.GetMe(ctx, &proto_users.GetMeRequest{Token: token})
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(resp.GetId(), 10), nil
+}
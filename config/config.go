@@ -1,54 +1,354 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type Config struct {
-	Env               string
-	LocalAddress      string
-	Address           string
-	ChatAddress       string
-	PlacesAddress     string
-	CharityAddress    string
-	VotesAddress      string
-	AuthAddress       string
-	UsersAddress      string
-	Timeout           time.Duration
-	IdleTimeout       time.Duration
-	MongoDBName       string
-	MongoDBCollection string
-	MongoDBPath       string
-	KafkaBrokers      []string
-	RequestTopic      string
-	ResponseTopic     string
-	ResponseTimeout   time.Duration
+	Env                string
+	LocalAddress       string
+	Address            string
+	TLSCertFile        string
+	TLSKeyFile         string
+	TLSMinVersion      string
+	HTTP2              bool
+	H2C                bool
+	RedirectAddress    string
+	ChatAddress        string
+	PlacesAddress      string
+	CharityAddress     string
+	VotesAddress       string
+	AuthAddress        string
+	UsersAddress       string
+	ChatGRPC           GRPCClientConfig
+	PlacesGRPC         GRPCClientConfig
+	CharityGRPC        GRPCClientConfig
+	VotesGRPC          GRPCClientConfig
+	AuthGRPC           GRPCClientConfig
+	UsersGRPC          GRPCClientConfig
+	Timeout            time.Duration
+	IdleTimeout        time.Duration
+	ShutdownTimeout    time.Duration
+	MongoDBName        string
+	MongoDBCollection  string
+	MongoDBPath        string
+	DeviceTokenTTL     time.Duration
+	ChatTransport      string
+	KafkaBrokers       []string
+	RequestTopic       string
+	ResponseTopic      string
+	ResponseTimeout    time.Duration
+	ChatQueueDepth     int
+	WSTicketSecret     string
+	WSTicketTTL        time.Duration
+	WSTicketStore      string
+	WSSessionTTL       time.Duration
+	WSSessionBuffer    int
+	InstanceID         string
+	ReplyRetention     time.Duration
+	ReplyReplication   int
+	NotificationsTopic string
+	NotificationsGroup string
+	EventsTopic        string
+	EventsGroup        string
+	WSFanoutBackend    string
+	WSFanoutTopic      string
+	WSFanoutChannel    string
+	RedisAddress       string
+	RedisPassword      string
+	RedisDB            int
+	RateLimitStore     string
+	RateLimitAuth      string
+	RateLimitPayment   string
+	RateLimitChat      string
+	PushProvider       string
+	FCMCredentialsFile string
+	APNsKeyFile        string
+	APNsKeyID          string
+	APNsTeamID         string
+	APNsTopic          string
+	APNsProduction     bool
+	JWTSecret          string
+	JWKSURL            string
+	JWKSRefresh        time.Duration
+	JWTIssuer          string
+	JWTAudience        string
+	JWTUserIDClaim     string
+	VectorURL          string
+	HealthInterval     time.Duration
+	HealthTimeout      time.Duration
+	HealthCritical     []string
+
+	// Per-route upstream timeouts.
+	RouteTimeout        time.Duration
+	RouteTimeoutShort   time.Duration
+	RouteTimeoutPayment time.Duration
+	RouteTimeoutUpload  time.Duration
+
+	// CORS policy, shared with the WebSocket origin check.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSExposedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// Brute-force protection for sign-in and email confirmation.
+	BruteForceStore        string
+	SignInLockoutThreshold int
+	SignInLockoutBase      time.Duration
+	SignInLockoutMax       time.Duration
+	SignInFailureWindow    time.Duration
+	SignInChallengeAfter   int
+	ConfirmMaxAttempts     int
+	ConfirmWindow          time.Duration
+	ChallengeProvider      string
+	ChallengeVerifyURL     string
+	ChallengeSecret        string
+	ChallengeStubToken     string
+
+	// Proxies whose X-Forwarded-For and X-Real-IP headers are trusted.
+	TrustedProxies []string
+}
+
+// GRPCClientConfig tunes the connection to one upstream. Every value except
+// the TLS server name is read from <SERVICE>_GRPC_<NAME>, falling back to
+// GRPC_<NAME>. Insecure connections are only allowed with ENV=local.
+type GRPCClientConfig struct {
+	Insecure                bool
+	TLSCAFile               string
+	TLSCertFile             string
+	TLSKeyFile              string
+	TLSServerName           string
+	RetryMaxAttempts        int
+	RetryInitialBackoff     time.Duration
+	RetryMaxBackoff         time.Duration
+	ConnectBaseDelay        time.Duration
+	ConnectMaxDelay         time.Duration
+	ConnectTimeout          time.Duration
+	KeepaliveTime           time.Duration
+	KeepaliveTimeout        time.Duration
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+	BreakerHalfOpenRequests int
+	FallbackTTL             time.Duration
+	FallbackMaxEntries      int
+}
+
+// Load reads the configuration from the environment and rejects settings the
+// gateway cannot run with.
+func Load() (*Config, error) {
+	env := getEnv("ENV", "local")
+
+	cfg := &Config{
+		Env:                env,
+		Address:            getEnv("SERVICE_ADDRESS", ":8080"),
+		LocalAddress:       getEnv("LOCAL_ADDRESS", "0.0.0.0:8080"),
+		TLSCertFile:        getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:         getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion:      getEnv("TLS_MIN_VERSION", "1.2"),
+		HTTP2:              getBoolEnv("HTTP2_ENABLED", true),
+		H2C:                getBoolEnv("HTTP_H2C", false),
+		RedirectAddress:    getEnv("HTTP_REDIRECT_ADDRESS", ""),
+		ChatAddress:        getEnv("CHAT_SERVICE_ADDRESS", ""),
+		PlacesAddress:      getEnv("PLACES_SERVICE_ADDRESS", ""),
+		CharityAddress:     getEnv("CHARITY_SERVICE_ADDRESS", ""),
+		VotesAddress:       getEnv("VOTES_SERVICE_ADDRESS", ""),
+		AuthAddress:        getEnv("AUTH_SERVICE_ADDRESS", ""),
+		UsersAddress:       getEnv("USERS_SERVICE_ADDRESS", ""),
+		ChatGRPC:           getGRPCClientConfig("CHAT", env),
+		PlacesGRPC:         getGRPCClientConfig("PLACES", env),
+		CharityGRPC:        getGRPCClientConfig("CHARITY", env),
+		VotesGRPC:          getGRPCClientConfig("VOTES", env),
+		AuthGRPC:           getGRPCClientConfig("AUTH", env),
+		UsersGRPC:          getGRPCClientConfig("USERS", env),
+		Timeout:            getDurationEnv("TIMEOUT", time.Second*15),
+		IdleTimeout:        getDurationEnv("IDLE_TIMEOUT", time.Second*60),
+		ShutdownTimeout:    getDurationEnv("SHUTDOWN_TIMEOUT", time.Second*30),
+		MongoDBName:        getEnv("MONGODB_NAME", ""),
+		MongoDBCollection:  getEnv("MONGODB_COLLECTION", ""),
+		MongoDBPath:        getEnv("MONGODB_PATH", ""),
+		DeviceTokenTTL:     getDurationEnv("DEVICE_TOKEN_TTL", time.Hour*24*60),
+		ChatTransport:      getEnv("CHAT_TRANSPORT", "kafka"),
+		KafkaBrokers:       getSliceEnv("KAFKA_BROKERS", []string{"localhost:9092"}),
+		RequestTopic:       getEnv("KAFKA_REQUEST_TOPIC", "request_topic"),
+		ResponseTopic:      getEnv("KAFKA_RESPONSE_TOPIC", "response_topic"),
+		ResponseTimeout:    getDurationEnv("KAFKA_RESPONSE_TIMEOUT", time.Second*30),
+		ChatQueueDepth:     getIntEnv("CHAT_QUEUE_DEPTH", 5),
+		WSTicketSecret:     getEnv("WS_TICKET_SECRET", ""),
+		WSTicketTTL:        getDurationEnv("WS_TICKET_TTL", time.Second*30),
+		WSTicketStore:      getEnv("WS_TICKET_STORE", "memory"),
+		WSSessionTTL:       getDurationEnv("WS_SESSION_TTL", time.Minute*2),
+		WSSessionBuffer:    getIntEnv("WS_SESSION_BUFFER", 100),
+		InstanceID:         getEnv("GATEWAY_INSTANCE_ID", defaultInstanceID()),
+		ReplyRetention:     getDurationEnv("KAFKA_REPLY_TOPIC_RETENTION", time.Hour),
+		ReplyReplication:   getIntEnv("KAFKA_REPLY_TOPIC_REPLICATION", 1),
+		NotificationsTopic: getEnv("KAFKA_NOTIFICATIONS_TOPIC", "notification_events"),
+		NotificationsGroup: getEnv("KAFKA_NOTIFICATIONS_GROUP", "gateway-notifications"),
+		EventsTopic:        getEnv("KAFKA_EVENTS_TOPIC", "realtime_events"),
+		EventsGroup:        getEnv("KAFKA_EVENTS_GROUP", "gateway-events"),
+		WSFanoutBackend:    getEnv("WS_FANOUT_BACKEND", "kafka"),
+		WSFanoutTopic:      getEnv("KAFKA_WS_FANOUT_TOPIC", "gateway_ws_fanout"),
+		WSFanoutChannel:    getEnv("REDIS_WS_FANOUT_CHANNEL", "gateway:ws:fanout"),
+		RedisAddress:       getEnv("REDIS_ADDRESS", "localhost:6379"),
+		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
+		RedisDB:            getIntEnv("REDIS_DB", 0),
+		RateLimitStore:     getEnv("RATE_LIMIT_STORE", "memory"),
+		RateLimitAuth:      getEnv("RATE_LIMIT_AUTH", "10/1m"),
+		RateLimitPayment:   getEnv("RATE_LIMIT_PAYMENT", "20/1m"),
+		RateLimitChat:      getEnv("RATE_LIMIT_CHAT", "60/1m"),
+		PushProvider:       getEnv("PUSH_PROVIDER", ""),
+		FCMCredentialsFile: getEnv("FCM_CREDENTIALS_FILE", ""),
+		APNsKeyFile:        getEnv("APNS_KEY_FILE", ""),
+		APNsKeyID:          getEnv("APNS_KEY_ID", ""),
+		APNsTeamID:         getEnv("APNS_TEAM_ID", ""),
+		APNsTopic:          getEnv("APNS_TOPIC", ""),
+		APNsProduction:     getBoolEnv("APNS_PRODUCTION", false),
+		JWTSecret:          getEnv("JWT_SECRET", ""),
+		JWKSURL:            getEnv("JWT_JWKS_URL", ""),
+		JWKSRefresh:        getDurationEnv("JWT_JWKS_REFRESH_INTERVAL", time.Minute*10),
+		JWTIssuer:          getEnv("JWT_ISSUER", ""),
+		JWTAudience:        getEnv("JWT_AUDIENCE", ""),
+		JWTUserIDClaim:     getEnv("JWT_USER_ID_CLAIM", "sub"),
+		VectorURL:          getEnv("VECTOR_URL", "http://infrastructure_vector_1:9880"),
+		HealthInterval:     getDurationEnv("HEALTH_CHECK_INTERVAL", time.Second*10),
+		HealthTimeout:      getDurationEnv("HEALTH_CHECK_TIMEOUT", time.Second*3),
+		HealthCritical:     getSliceEnv("HEALTH_CRITICAL", []string{"mongo", "kafka_producer", "kafka_consumer", "auth", "users"}),
+
+		// Per-route upstream timeouts.
+		RouteTimeout:        getDurationEnv("ROUTE_TIMEOUT", time.Second*5),
+		RouteTimeoutShort:   getDurationEnv("ROUTE_TIMEOUT_SHORT", time.Second*2),
+		RouteTimeoutPayment: getDurationEnv("ROUTE_TIMEOUT_PAYMENT", time.Second*10),
+		RouteTimeoutUpload:  getDurationEnv("ROUTE_TIMEOUT_UPLOAD", time.Second*60),
+
+		// CORS policy, shared with the WebSocket origin check.
+		CORSAllowedOrigins:   getSliceEnv("CORS_ALLOWED_ORIGINS", getSliceEnv("WS_ALLOWED_ORIGINS", []string{})),
+		CORSAllowedMethods:   getSliceEnv("CORS_ALLOWED_METHODS", []string{"GET", "POST", "DELETE", "OPTIONS"}),
+		CORSAllowedHeaders:   getSliceEnv("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "Last-Event-ID", "X-Challenge-Token"}),
+		CORSExposedHeaders:   getSliceEnv("CORS_EXPOSED_HEADERS", []string{"Retry-After", "Warning", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Challenge-Provider"}),
+		CORSAllowCredentials: getBoolEnv("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           getDurationEnv("CORS_MAX_AGE", time.Minute*10),
+
+		// Brute-force protection for sign-in and email confirmation.
+		BruteForceStore:        getEnv("BRUTEFORCE_STORE", "memory"),
+		SignInLockoutThreshold: getIntEnv("SIGNIN_LOCKOUT_THRESHOLD", 5),
+		SignInLockoutBase:      getDurationEnv("SIGNIN_LOCKOUT_BASE", time.Second*30),
+		SignInLockoutMax:       getDurationEnv("SIGNIN_LOCKOUT_MAX", time.Minute*15),
+		SignInFailureWindow:    getDurationEnv("SIGNIN_FAILURE_WINDOW", time.Hour),
+		SignInChallengeAfter:   getIntEnv("SIGNIN_CHALLENGE_AFTER", 3),
+		ConfirmMaxAttempts:     getIntEnv("CONFIRM_MAX_ATTEMPTS", 10),
+		ConfirmWindow:          getDurationEnv("CONFIRM_ATTEMPTS_WINDOW", time.Hour),
+		ChallengeProvider:      getEnv("CHALLENGE_PROVIDER", ""),
+		ChallengeVerifyURL:     getEnv("CHALLENGE_VERIFY_URL", ""),
+		ChallengeSecret:        getEnv("CHALLENGE_SECRET", ""),
+		ChallengeStubToken:     getEnv("CHALLENGE_STUB_TOKEN", "stub-token"),
+
+		// Proxies whose X-Forwarded-For and X-Real-IP headers are trusted.
+		TrustedProxies: getSliceEnv("TRUSTED_PROXIES", []string{}),
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	if c.Env != "local" {
+		if c.WSTicketSecret == "" {
+			// Tickets are redeemed by whichever replica gets the upgrade request.
+			errs = append(errs, errors.New("WS_TICKET_SECRET is required outside ENV=local"))
+		}
+
+		upstreams := []struct {
+			service string
+			grpc    GRPCClientConfig
+		}{
+			{"CHAT", c.ChatGRPC},
+			{"PLACES", c.PlacesGRPC},
+			{"CHARITY", c.CharityGRPC},
+			{"VOTES", c.VotesGRPC},
+			{"AUTH", c.AuthGRPC},
+			{"USERS", c.UsersGRPC},
+		}
+		for _, upstream := range upstreams {
+			if upstream.grpc.Insecure {
+				errs = append(errs, fmt.Errorf("insecure gRPC transport for %s is only allowed with ENV=local", upstream.service))
+			}
+		}
+	}
+	if c.ChatQueueDepth <= 0 {
+		errs = append(errs, errors.New("CHAT_QUEUE_DEPTH must be positive"))
+	}
+	if c.WSSessionBuffer <= 0 {
+		errs = append(errs, errors.New("WS_SESSION_BUFFER must be positive"))
+	}
+	// The hub sweeps replay logs every WS_SESSION_TTL/2, and a ticker needs a
+	// positive period.
+	if c.WSSessionTTL < time.Second {
+		errs = append(errs, errors.New("WS_SESSION_TTL must be at least 1s"))
+	}
+	if c.CORSAllowCredentials && slices.ContainsFunc(c.CORSAllowedOrigins, func(origin string) bool {
+		return strings.TrimSpace(origin) == "*"
+	}) {
+		errs = append(errs, errors.New("CORS_ALLOW_CREDENTIALS cannot be combined with CORS_ALLOWED_ORIGINS=*"))
+	}
+	if c.SignInFailureWindow < c.SignInLockoutMax {
+		// Otherwise the failures expire while the key is still locked out.
+		errs = append(errs, errors.New("SIGNIN_FAILURE_WINDOW must not be shorter than SIGNIN_LOCKOUT_MAX"))
+	}
+	return errors.Join(errs...)
+}
+
+func getGRPCClientConfig(service, env string) GRPCClientConfig {
+	str := func(name string) string {
+		return getEnv(service+"_GRPC_"+name, getEnv("GRPC_"+name, ""))
+	}
+	duration := func(name string, defaultValue time.Duration) time.Duration {
+		return getDurationEnv(service+"_GRPC_"+name, getDurationEnv("GRPC_"+name, defaultValue))
+	}
+	integer := func(name string, defaultValue int) int {
+		return getIntEnv(service+"_GRPC_"+name, getIntEnv("GRPC_"+name, defaultValue))
+	}
+
+	// Upstreams are dialed over TLS unless ENV=local, where plaintext stays the
+	// default so local setups keep working without certificates.
+	insecure := getBoolEnv(service+"_GRPC_INSECURE", getBoolEnv("GRPC_INSECURE", env == "local"))
+
+	return GRPCClientConfig{
+		Insecure:                insecure,
+		TLSCAFile:               str("TLS_CA_FILE"),
+		TLSCertFile:             str("TLS_CERT_FILE"),
+		TLSKeyFile:              str("TLS_KEY_FILE"),
+		TLSServerName:           getEnv(service+"_GRPC_TLS_SERVER_NAME", ""),
+		RetryMaxAttempts:        integer("RETRY_MAX_ATTEMPTS", 3),
+		RetryInitialBackoff:     duration("RETRY_INITIAL_BACKOFF", time.Millisecond*100),
+		RetryMaxBackoff:         duration("RETRY_MAX_BACKOFF", time.Second),
+		ConnectBaseDelay:        duration("CONNECT_BASE_DELAY", time.Second),
+		ConnectMaxDelay:         duration("CONNECT_MAX_DELAY", time.Second*30),
+		ConnectTimeout:          duration("CONNECT_TIMEOUT", time.Second*5),
+		KeepaliveTime:           duration("KEEPALIVE_TIME", time.Minute*5),
+		KeepaliveTimeout:        duration("KEEPALIVE_TIMEOUT", time.Second*20),
+		BreakerFailureThreshold: integer("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerOpenTimeout:      duration("BREAKER_OPEN_TIMEOUT", time.Second*30),
+		BreakerHalfOpenRequests: integer("BREAKER_HALF_OPEN_REQUESTS", 1),
+		FallbackTTL:             duration("FALLBACK_TTL", time.Minute*10),
+		FallbackMaxEntries:      integer("FALLBACK_MAX_ENTRIES", 1000),
+	}
 }
 
-func MustLoad() *Config {
-	return &Config{
-		Env:               getEnv("ENV", "local"),
-		Address:           getEnv("SERVICE_ADDRESS", ":8080"),
-		LocalAddress:      getEnv("LOCAL_ADDRESS", "0.0.0.0:8080"),
-		ChatAddress:       getEnv("CHAT_SERVICE_ADDRESS", ""),
-		PlacesAddress:     getEnv("PLACES_SERVICE_ADDRESS", ""),
-		CharityAddress:    getEnv("CHARITY_SERVICE_ADDRESS", ""),
-		VotesAddress:      getEnv("VOTES_SERVICE_ADDRESS", ""),
-		AuthAddress:       getEnv("AUTH_SERVICE_ADDRESS", ""),
-		UsersAddress:      getEnv("USERS_SERVICE_ADDRESS", ""),
-		Timeout:           getDurationEnv("TIMEOUT", time.Second*15),
-		IdleTimeout:       getDurationEnv("IDLE_TIMEOUT", time.Second*60),
-		MongoDBName:       getEnv("MONGODB_NAME", ""),
-		MongoDBCollection: getEnv("MONGODB_COLLECTION", ""),
-		MongoDBPath:       getEnv("MONGODB_PATH", ""),
-		KafkaBrokers:      getSliceEnv("KAFKA_BROKERS", []string{"localhost:9092"}),
-		RequestTopic:      getEnv("KAFKA_REQUEST_TOPIC", "request_topic"),
-		ResponseTopic:     getEnv("KAFKA_RESPONSE_TOPIC", "response_topic"),
-		ResponseTimeout:   getDurationEnv("KAFKA_RESPONSE_TIMEOUT", time.Second*30),
+func defaultInstanceID() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
 	}
+	return "gateway"
 }
 
 func getEnv(key, defaultValue string) string {
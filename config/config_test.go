@@ -0,0 +1,126 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadValidation(t *testing.T) {
+	production := map[string]string{
+		"ENV":              "production",
+		"WS_TICKET_SECRET": "secret",
+	}
+	with := func(base map[string]string, key, value string) map[string]string {
+		env := map[string]string{key: value}
+		for k, v := range base {
+			if k != key {
+				env[k] = v
+			}
+		}
+		return env
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "local defaults", env: map[string]string{}},
+		{name: "production with ticket secret", env: production},
+		{
+			name:    "production without ticket secret",
+			env:     map[string]string{"ENV": "production"},
+			wantErr: "WS_TICKET_SECRET",
+		},
+		{
+			name: "insecure upstream in local",
+			env:  map[string]string{"GRPC_INSECURE": "true"},
+		},
+		{
+			name:    "insecure upstream in production",
+			env:     with(production, "AUTH_GRPC_INSECURE", "true"),
+			wantErr: "insecure gRPC transport for AUTH",
+		},
+		{
+			name:    "failure window shorter than lockout",
+			env:     map[string]string{"SIGNIN_LOCKOUT_MAX": "2h", "SIGNIN_FAILURE_WINDOW": "1h"},
+			wantErr: "SIGNIN_FAILURE_WINDOW",
+		},
+		{
+			name:    "credentials with any origin",
+			env:     map[string]string{"CORS_ALLOWED_ORIGINS": "https://app.example.com, *", "CORS_ALLOW_CREDENTIALS": "true"},
+			wantErr: "CORS_ALLOW_CREDENTIALS",
+		},
+		{
+			name: "credentials with listed origins",
+			env:  map[string]string{"CORS_ALLOWED_ORIGINS": "https://app.example.com", "CORS_ALLOW_CREDENTIALS": "true"},
+		},
+		{
+			name:    "zero chat queue depth",
+			env:     map[string]string{"CHAT_QUEUE_DEPTH": "0"},
+			wantErr: "CHAT_QUEUE_DEPTH",
+		},
+		{
+			name:    "zero session buffer",
+			env:     map[string]string{"WS_SESSION_BUFFER": "0"},
+			wantErr: "WS_SESSION_BUFFER",
+		},
+		{
+			name:    "negative session ttl",
+			env:     map[string]string{"WS_SESSION_TTL": "-1s"},
+			wantErr: "WS_SESSION_TTL",
+		},
+		{
+			name:    "session ttl below a second",
+			env:     map[string]string{"WS_SESSION_TTL": "1ns"},
+			wantErr: "WS_SESSION_TTL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				if cfg == nil {
+					t.Fatal("Load() returned no config")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() error = %v, want it to mention %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadGRPCInsecureDefault(t *testing.T) {
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{env: "local", want: true},
+		{env: "production", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("ENV", tt.env)
+			t.Setenv("WS_TICKET_SECRET", "secret")
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.AuthGRPC.Insecure != tt.want {
+				t.Errorf("AuthGRPC.Insecure = %v, want %v", cfg.AuthGRPC.Insecure, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package bruteforce
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ChallengeHeader carries the solved CAPTCHA or proof-of-work token.
+const ChallengeHeader = "X-Challenge-Token"
+
+var ErrChallengeFailed = errors.New("challenge verification failed")
+
+// Verifier checks a challenge response, e.g. with a CAPTCHA provider or a
+// proof-of-work scheme.
+type Verifier interface {
+	Name() string
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+// StubVerifier accepts a single fixed token. It is meant for local runs and
+// tests.
+type StubVerifier struct {
+	token string
+}
+
+func NewStubVerifier(token string) *StubVerifier {
+	return &StubVerifier{token: token}
+}
+
+func (v *StubVerifier) Name() string {
+	return "stub"
+}
+
+func (v *StubVerifier) Verify(_ context.Context, response, _ string) error {
+	if response == "" || subtle.ConstantTimeCompare([]byte(response), []byte(v.token)) != 1 {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// SiteVerifier checks tokens with a provider speaking the siteverify
+// protocol shared by reCAPTCHA, hCaptcha and Turnstile.
+type SiteVerifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewSiteVerifier(verifyURL, secret string) *SiteVerifier {
+	return &SiteVerifier{
+		url:    verifyURL,
+		secret: secret,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (v *SiteVerifier) Name() string {
+	return "siteverify"
+}
+
+func (v *SiteVerifier) Verify(ctx context.Context, response, remoteIP string) error {
+	if response == "" {
+		return ErrChallengeFailed
+	}
+
+	form := url.Values{
+		"secret":   {v.secret},
+		"response": {response},
+		"remoteip": {remoteIP},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach challenge provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode challenge provider response: %w", err)
+	}
+	if !result.Success {
+		return ErrChallengeFailed
+	}
+	return nil
+}
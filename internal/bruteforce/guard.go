@@ -0,0 +1,122 @@
+package bruteforce
+
+import (
+	"context"
+	"time"
+)
+
+// Policy describes the progressive lockout. Once a key collects Threshold
+// failures it is locked for BaseLockout, and every further failure doubles
+// the lockout up to MaxLockout. Failures are forgotten after Window without
+// new ones, so Window must not be shorter than MaxLockout. After
+// ChallengeAfter failures callers must also pass a challenge; zero disables
+// the challenge.
+type Policy struct {
+	Threshold      int
+	BaseLockout    time.Duration
+	MaxLockout     time.Duration
+	Window         time.Duration
+	ChallengeAfter int
+}
+
+func (p Policy) lockout(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.Threshold; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if p.MaxLockout > 0 && lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+	return lockout
+}
+
+// Decision is the outcome of checking a set of keys before an attempt.
+type Decision struct {
+	RetryAfter        time.Duration
+	ChallengeRequired bool
+}
+
+// Locked reports whether the attempt must be rejected without trying.
+func (d Decision) Locked() bool {
+	return d.RetryAfter > 0
+}
+
+// Guard tracks failed attempts per key, e.g. per email and per IP, and
+// decides when further attempts are locked out or need a challenge.
+type Guard struct {
+	store  Store
+	prefix string
+	policy Policy
+}
+
+func NewGuard(store Store, prefix string, policy Policy) *Guard {
+	return &Guard{store: store, prefix: prefix, policy: policy}
+}
+
+// Attempt is one try that Begin already counted as a failure. The caller
+// forgives it unless the try really failed.
+type Attempt struct {
+	Decision
+	guard   *Guard
+	keys    []string
+	records []Record
+}
+
+// Begin counts an attempt as a failure for every key before it is tried and
+// returns the strictest decision over the keys. Counting first makes the
+// check atomic: of concurrent attempts, only those the threshold still allows
+// get through. Attempts rejected as locked are forgiven right away, so
+// retrying during a lockout does not extend it.
+func (g *Guard) Begin(ctx context.Context, keys ...string) (*Attempt, error) {
+	attempt := &Attempt{guard: g}
+	now := time.Now()
+
+	for _, key := range keys {
+		record, err := g.store.Fail(ctx, g.prefix+key, g.policy.Window)
+		if err != nil {
+			return attempt, err
+		}
+		attempt.keys = append(attempt.keys, key)
+		attempt.records = append(attempt.records, record)
+
+		// The decision follows the failures before this attempt.
+		failures := record.Failures - 1
+		if retryAfter := record.PreviousFailure.Add(g.policy.lockout(failures)).Sub(now); retryAfter > attempt.RetryAfter {
+			attempt.RetryAfter = retryAfter
+		}
+		if g.policy.ChallengeAfter > 0 && failures >= g.policy.ChallengeAfter {
+			attempt.ChallengeRequired = true
+		}
+	}
+
+	if attempt.Locked() {
+		return attempt, attempt.Forgive(ctx)
+	}
+	return attempt, nil
+}
+
+// Forgive takes back the failure Begin counted, for attempts that succeeded
+// or were not tried. It still runs after ctx is cancelled.
+func (a *Attempt) Forgive(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
+	for i, key := range a.keys {
+		if err := a.guard.store.Forgive(ctx, a.guard.prefix+key, a.records[i]); err != nil {
+			return err
+		}
+	}
+	a.keys, a.records = nil, nil
+	return nil
+}
+
+// Reset forgets the failures of the keys after a successful attempt.
+func (g *Guard) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := g.store.Reset(ctx, g.prefix+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
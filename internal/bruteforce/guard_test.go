@@ -0,0 +1,151 @@
+package bruteforce
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPolicyLockout(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseLockout: 30 * time.Second, MaxLockout: 5 * time.Minute}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		want     time.Duration
+	}{
+		{name: "no failures", policy: policy, failures: 0, want: 0},
+		{name: "below threshold", policy: policy, failures: 2, want: 0},
+		{name: "at threshold", policy: policy, failures: 3, want: 30 * time.Second},
+		{name: "doubles per failure", policy: policy, failures: 5, want: 2 * time.Minute},
+		{name: "capped at max", policy: policy, failures: 20, want: 5 * time.Minute},
+		{
+			name:     "no max keeps the base lockout",
+			policy:   Policy{Threshold: 1, BaseLockout: time.Second},
+			failures: 4,
+			want:     time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.lockout(tt.failures); got != tt.want {
+				t.Errorf("lockout(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardBegin(t *testing.T) {
+	policy := Policy{
+		Threshold:      3,
+		BaseLockout:    time.Minute,
+		MaxLockout:     time.Hour,
+		Window:         time.Hour,
+		ChallengeAfter: 2,
+	}
+
+	tests := []struct {
+		name          string
+		failures      int
+		forgiven      int
+		wantLocked    bool
+		wantChallenge bool
+	}{
+		{name: "first attempt"},
+		{name: "below challenge", failures: 1},
+		{name: "challenge required", failures: 2, wantChallenge: true},
+		{name: "locked at threshold", failures: 3, wantLocked: true, wantChallenge: true},
+		{name: "forgiven attempts do not count", failures: 3, forgiven: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			defer store.Close()
+			guard := NewGuard(store, "test:", policy)
+			ctx := context.Background()
+
+			for i := 0; i < tt.failures; i++ {
+				attempt, err := guard.Begin(ctx, "email:a", "ip:1")
+				if err != nil {
+					t.Fatalf("Begin() error = %v", err)
+				}
+				if i < tt.forgiven {
+					if err := attempt.Forgive(ctx); err != nil {
+						t.Fatalf("Forgive() error = %v", err)
+					}
+				}
+			}
+
+			attempt, err := guard.Begin(ctx, "email:a", "ip:1")
+			if err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+			if attempt.Locked() != tt.wantLocked {
+				t.Errorf("Locked() = %v, want %v", attempt.Locked(), tt.wantLocked)
+			}
+			if attempt.Locked() && attempt.RetryAfter > policy.BaseLockout {
+				t.Errorf("RetryAfter = %v, want at most %v", attempt.RetryAfter, policy.BaseLockout)
+			}
+			if attempt.ChallengeRequired != tt.wantChallenge {
+				t.Errorf("ChallengeRequired = %v, want %v", attempt.ChallengeRequired, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestGuardBeginLockedDoesNotEscalate(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Close()
+	guard := NewGuard(store, "test:", Policy{Threshold: 1, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+	ctx := context.Background()
+
+	if attempt, _ := guard.Begin(ctx, "ip:1"); attempt.Locked() {
+		t.Fatal("first attempt is locked")
+	}
+	for i := 0; i < 5; i++ {
+		attempt, err := guard.Begin(ctx, "ip:1")
+		if err != nil {
+			t.Fatalf("Begin() error = %v", err)
+		}
+		if !attempt.Locked() || attempt.RetryAfter > time.Minute {
+			t.Fatalf("retry %d: RetryAfter = %v, want locked for at most %v", i, attempt.RetryAfter, time.Minute)
+		}
+	}
+}
+
+func TestGuardBeginConcurrent(t *testing.T) {
+	const threshold = 5
+
+	store := NewMemoryStore()
+	defer store.Close()
+	guard := NewGuard(store, "test:", Policy{Threshold: threshold, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt, err := guard.Begin(context.Background(), "email:a")
+			if err != nil {
+				t.Errorf("Begin() error = %v", err)
+				return
+			}
+			if !attempt.Locked() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != threshold {
+		t.Errorf("%d concurrent attempts allowed, want %d", allowed, threshold)
+	}
+}
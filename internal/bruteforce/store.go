@@ -0,0 +1,192 @@
+package bruteforce
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Record holds the recent failures of one key. PreviousFailure is the last
+// failure before the one Fail just recorded.
+type Record struct {
+	Failures        int
+	LastFailure     time.Time
+	PreviousFailure time.Time
+}
+
+type Store interface {
+	Fail(ctx context.Context, key string, ttl time.Duration) (Record, error)
+	// Forgive takes back the failure Fail returned as record. LastFailure is
+	// restored only if no failure was recorded since.
+	Forgive(ctx context.Context, key string, record Record) error
+	Reset(ctx context.Context, key string) error
+	Close() error
+}
+
+type memoryEntry struct {
+	record  Record
+	expires time.Time
+}
+
+// MemoryStore keeps the failures in process, so every replica counts them on
+// its own.
+type MemoryStore struct {
+	entries map[string]*memoryEntry
+	mu      sync.Mutex
+	stop    chan struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		stop:    make(chan struct{}),
+	}
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryStore) Fail(_ context.Context, key string, ttl time.Duration) (Record, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expires) {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	entry.record.Failures++
+	entry.record.PreviousFailure = entry.record.LastFailure
+	entry.record.LastFailure = now
+	entry.expires = now.Add(ttl)
+
+	return entry.record, nil
+}
+
+func (s *MemoryStore) Forgive(_ context.Context, key string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+	entry.record.Failures--
+	if entry.record.Failures <= 0 {
+		delete(s.entries, key)
+		return nil
+	}
+	if entry.record.LastFailure.Equal(record.LastFailure) {
+		entry.record.LastFailure = record.PreviousFailure
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			s.mu.Lock()
+			for key, entry := range s.entries {
+				if now.After(entry.expires) {
+					delete(s.entries, key)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	close(s.stop)
+	return nil
+}
+
+// RedisStore shares the failures between replicas.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// forgiveScript decrements the failures of KEYS[1] and puts back the previous
+// failure time ARGV[2] if the last one is still ARGV[1].
+var forgiveScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+local failures = redis.call("HINCRBY", KEYS[1], "failures", -1)
+if failures <= 0 then
+	redis.call("DEL", KEYS[1])
+	return 0
+end
+if redis.call("HGET", KEYS[1], "last") == ARGV[1] then
+	redis.call("HSET", KEYS[1], "last", ARGV[2])
+end
+return failures
+`)
+
+func (s *RedisStore) Fail(ctx context.Context, key string, ttl time.Duration) (Record, error) {
+	now := time.Now()
+	var previous *redis.SliceCmd
+	var failures *redis.IntCmd
+
+	// Commands in a transaction run in order, so previous sees the value
+	// before this failure.
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		previous = pipe.HMGet(ctx, s.prefix+key, "last")
+		failures = pipe.HIncrBy(ctx, s.prefix+key, "failures", 1)
+		pipe.HSet(ctx, s.prefix+key, "last", now.UnixMilli())
+		pipe.PExpire(ctx, s.prefix+key, ttl)
+		return nil
+	})
+	if err != nil {
+		return Record{}, err
+	}
+
+	record := Record{Failures: int(failures.Val()), LastFailure: now}
+	if raw, ok := previous.Val()[0].(string); ok {
+		if ms, err := strconv.ParseInt(raw, 10, 64); err == nil && ms > 0 {
+			record.PreviousFailure = time.UnixMilli(ms)
+		}
+	}
+	return record, nil
+}
+
+func (s *RedisStore) Forgive(ctx context.Context, key string, record Record) error {
+	previous := "0"
+	if !record.PreviousFailure.IsZero() {
+		previous = strconv.FormatInt(record.PreviousFailure.UnixMilli(), 10)
+	}
+	last := strconv.FormatInt(record.LastFailure.UnixMilli(), 10)
+
+	return forgiveScript.Run(ctx, s.client, []string{s.prefix + key}, last, previous).Err()
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
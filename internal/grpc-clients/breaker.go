@@ -0,0 +1,189 @@
+package grpc_clients
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	stateClosed = iota
+	stateHalfOpen
+	stateOpen
+)
+
+var stateNames = map[int]string{
+	stateClosed:   "closed",
+	stateHalfOpen: "half_open",
+	stateOpen:     "open",
+}
+
+var (
+	breakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "grpc_circuit_breaker_state",
+			Help: "Circuit breaker state per upstream: 0 closed, 1 half-open, 2 open",
+		},
+		[]string{"upstream"},
+	)
+	breakerTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_circuit_breaker_transitions_total",
+			Help: "Circuit breaker state transitions per upstream",
+		},
+		[]string{"upstream", "state"},
+	)
+	breakerRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_circuit_breaker_rejected_total",
+			Help: "Calls rejected by an open circuit breaker",
+		},
+		[]string{"upstream"},
+	)
+	fallbackServed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_fallback_responses_total",
+			Help: "Cached responses served while the circuit breaker was open",
+		},
+		[]string{"upstream", "method"},
+	)
+)
+
+// Metrics returns the collectors of the gRPC client resilience layer.
+func Metrics() []prometheus.Collector {
+	return []prometheus.Collector{breakerState, breakerTransitions, breakerRejected, fallbackServed}
+}
+
+// breaker counts consecutive upstream failures. After threshold failures it
+// opens and rejects calls for openTimeout, then lets halfOpenMax probe calls
+// through; one successful probe closes it again, a failed one reopens it.
+type breaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+	halfOpenMax int
+	state       int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	mu          sync.Mutex
+}
+
+func newBreaker(name string, threshold int, openTimeout time.Duration, halfOpenMax int) *breaker {
+	if halfOpenMax < 1 {
+		halfOpenMax = 1
+	}
+	breakerState.WithLabelValues(name).Set(stateClosed)
+
+	return &breaker{
+		name:        name,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		halfOpenMax: halfOpenMax,
+	}
+}
+
+// allow reports whether a call may proceed and whether it is a half-open
+// probe. Rejected calls get the time left until the next probe.
+func (b *breaker) allow() (probe bool, retryAfter time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == stateOpen {
+		elapsed := time.Since(b.openedAt)
+		if elapsed < b.openTimeout {
+			return false, b.openTimeout - elapsed, false
+		}
+		b.transition(stateHalfOpen)
+	}
+
+	if b.state == stateHalfOpen {
+		if b.probes >= b.halfOpenMax {
+			return false, time.Second, false
+		}
+		b.probes++
+		return true, 0, true
+	}
+
+	return false, 0, true
+}
+
+func (b *breaker) record(probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case probe && b.state == stateHalfOpen:
+		b.probes--
+		if failed {
+			b.transition(stateOpen)
+		} else {
+			b.transition(stateClosed)
+		}
+	case b.state == stateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.transition(stateOpen)
+		}
+	}
+}
+
+func (b *breaker) transition(state int) {
+	b.state = state
+	b.failures = 0
+	b.probes = 0
+	if state == stateOpen {
+		b.openedAt = time.Now()
+	}
+
+	breakerState.WithLabelValues(b.name).Set(float64(state))
+	breakerTransitions.WithLabelValues(b.name, stateNames[state]).Inc()
+}
+
+// isFailure reports whether err says the upstream itself is unhealthy, as
+// opposed to rejecting this particular request.
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+func (b *breaker) interceptor(cache *fallbackCache) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		// An open breaker must not fail health checks, and failed probes
+		// must not open it.
+		if isHealthCheck(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		probe, retryAfter, ok := b.allow()
+		if !ok {
+			breakerRejected.WithLabelValues(b.name).Inc()
+			if cache.load(method, req, reply) {
+				fallbackServed.WithLabelValues(b.name, method).Inc()
+				reportFrom(ctx).markStale()
+				return nil
+			}
+			reportFrom(ctx).markOpen(retryAfter)
+			return status.Errorf(codes.Unavailable, "circuit breaker for %s is open", b.name)
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(probe, isFailure(err))
+		if err == nil {
+			cache.store(method, req, reply)
+		}
+		return err
+	}
+}
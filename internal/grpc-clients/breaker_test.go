@@ -0,0 +1,95 @@
+package grpc_clients
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	placesproto "github.com/GP-Hacks/proto/pkg/api/places"
+	userproto "github.com/GP-Hacks/proto/pkg/api/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBreakerFallback(t *testing.T) {
+	cacheMethods := []string{placesproto.PlacesService_GetCategories_FullMethodName}
+
+	tests := []struct {
+		name      string
+		method    string
+		req       proto.Message
+		newReply  func() proto.Message
+		good      proto.Message
+		wantCache bool
+	}{
+		{
+			name:      "cached method",
+			method:    placesproto.PlacesService_GetCategories_FullMethodName,
+			req:       &placesproto.GetCategoriesRequest{},
+			newReply:  func() proto.Message { return &placesproto.GetCategoriesResponse{} },
+			good:      &placesproto.GetCategoriesResponse{Categories: []string{"museum"}},
+			wantCache: true,
+		},
+		{
+			name:     "token-bound method",
+			method:   userproto.UserService_GetMe_FullMethodName,
+			req:      &userproto.GetMeRequest{Token: "revoked"},
+			newReply: func() proto.Message { return &userproto.GetMeResponse{} },
+			good:     &userproto.GetMeResponse{Id: 1, AvatarURL: "avatar.png"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := newBreaker("test", 1, time.Minute, 1).interceptor(newFallbackCache(cacheMethods, time.Minute, 10))
+			ctx := context.Background()
+
+			succeed := func(_ context.Context, _ string, _, reply interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+				proto.Merge(reply.(proto.Message), tt.good)
+				return nil
+			}
+			fail := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				return status.Error(codes.Unavailable, "upstream down")
+			}
+			unreachable := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				t.Fatal("open breaker called the upstream")
+				return nil
+			}
+
+			if err := interceptor(ctx, tt.method, tt.req, tt.newReply(), nil, succeed); err != nil {
+				t.Fatalf("first call error = %v", err)
+			}
+			if err := interceptor(ctx, tt.method, tt.req, tt.newReply(), nil, fail); status.Code(err) != codes.Unavailable {
+				t.Fatalf("failing call error = %v, want Unavailable", err)
+			}
+
+			reply := tt.newReply()
+			ctx, report := WithCallReport(ctx)
+			err := interceptor(ctx, tt.method, tt.req, reply, nil, unreachable)
+
+			if tt.wantCache {
+				if err != nil {
+					t.Fatalf("open breaker error = %v, want cached reply", err)
+				}
+				if !proto.Equal(reply, tt.good) {
+					t.Errorf("reply = %v, want %v", reply, tt.good)
+				}
+				if !report.Stale() {
+					t.Error("cached reply not reported as stale")
+				}
+				return
+			}
+			if status.Code(err) != codes.Unavailable {
+				t.Fatalf("open breaker error = %v, want Unavailable", err)
+			}
+			if !proto.Equal(reply, tt.newReply()) {
+				t.Errorf("reply = %v, want it left empty", reply)
+			}
+			if _, open := report.CircuitOpen(); !open {
+				t.Error("rejected call not reported as circuit open")
+			}
+		})
+	}
+}
@@ -1,48 +1,27 @@
 package grpc_clients
 
 import (
-	"context"
-	"fmt"
-	"time"
-
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	grpcclients "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients"
 	proto "github.com/GP-Hacks/proto/pkg/api/charity"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-func SetupCharityClient(address string) (proto.CharityServiceClient, error) {
-	// log.Debug("Attempting to create gRPC connection", slog.String("address", address))
-
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		// log.Error("Failed to create gRPC connection", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("failed to create gRPC connection with charity service: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			_ = conn.Close()
-			// log.Info("Closed gRPC connection due to error", slog.String("address", address))
-		}
-	}()
-
-	charityClient := proto.NewCharityServiceClient(conn)
+var retryMethods = []string{
+	proto.CharityService_GetCollections_FullMethodName,
+	proto.CharityService_GetCategories_FullMethodName,
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+var cacheMethods = []string{
+	proto.CharityService_GetCollections_FullMethodName,
+	proto.CharityService_GetCategories_FullMethodName,
+}
 
-	// log.Debug("Performing health check on charity service", slog.String("address", address))
-	healthResponse, err := charityClient.HealthCheck(ctx, &proto.HealthCheckRequest{})
+func SetupCharityClient(address string, cfg config.GRPCClientConfig) (proto.CharityServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpcclients.Dial("charity", address, cfg, retryMethods, cacheMethods)
 	if err != nil {
-		// log.Error("Health check failed", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("health check failed: %w", err)
-	}
-
-	if !healthResponse.IsHealthy {
-		err = fmt.Errorf("charity service is not healthy")
-		// log.Warn("Charity service reported as unhealthy", slog.String("address", address))
-		return nil, err
+		return nil, nil, err
 	}
 
-	// log.Info("Successfully connected to charity service", slog.String("address", address))
-	return charityClient, nil
+	return proto.NewCharityServiceClient(conn), conn, nil
 }
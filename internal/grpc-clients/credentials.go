@@ -0,0 +1,90 @@
+package grpc_clients
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/tlsreload"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// transportCredentials builds TLS credentials for an upstream. Without a CA
+// bundle the system roots are used; a client key pair enables mTLS.
+func transportCredentials(cfg config.GRPCClientConfig) (credentials.TransportCredentials, error) {
+	if cfg.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+
+	creds := &reloadingCredentials{
+		base: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: cfg.TLSServerName,
+		},
+	}
+
+	if cfg.TLSCAFile != "" {
+		roots, err := tlsreload.NewCertPool(cfg.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		creds.roots = roots
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		keyPair, err := tlsreload.NewKeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		creds.base.GetClientCertificate = keyPair.GetClientCertificate
+	}
+
+	return creds, nil
+}
+
+// reloadingCredentials builds the TLS config for every handshake, so new
+// connections pick up a rotated CA bundle or client certificate.
+type reloadingCredentials struct {
+	base  *tls.Config
+	roots *tlsreload.CertPool
+	mu    sync.RWMutex
+}
+
+func (c *reloadingCredentials) current() credentials.TransportCredentials {
+	c.mu.RLock()
+	cfg := c.base.Clone()
+	c.mu.RUnlock()
+	if c.roots != nil {
+		cfg.RootCAs = c.roots.Pool()
+	}
+	return credentials.NewTLS(cfg)
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("upstream credentials are client-only")
+}
+
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return c.current().Info()
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &reloadingCredentials{base: c.base.Clone(), roots: c.roots}
+}
+
+func (c *reloadingCredentials) OverrideServerName(serverName string) error {
+	c.mu.Lock()
+	c.base.ServerName = serverName
+	c.mu.Unlock()
+	return nil
+}
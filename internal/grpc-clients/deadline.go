@@ -0,0 +1,38 @@
+package grpc_clients
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// BudgetMetadataKey carries the milliseconds left until the caller's deadline,
+// so upstreams can skip work nobody will wait for.
+const BudgetMetadataKey = "x-request-budget-ms"
+
+// deadlineInterceptor fails calls whose deadline has already passed without
+// touching the network and passes the remaining budget to the upstream.
+func deadlineInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if isHealthCheck(method) {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		budget := time.Until(deadline)
+		if budget <= 0 {
+			reportFrom(ctx).markTimedOut()
+			return status.Errorf(codes.DeadlineExceeded, "deadline exceeded before calling %s", method)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, BudgetMetadataKey, strconv.FormatInt(budget.Milliseconds(), 10))
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if status.Code(err) == codes.DeadlineExceeded {
+		reportFrom(ctx).markTimedOut()
+	}
+	return err
+}
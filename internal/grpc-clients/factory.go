@@ -0,0 +1,127 @@
+package grpc_clients
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Dial creates a client connection that connects in the background and
+// reconnects with exponential backoff, so startup does not depend on the
+// upstream being available. Every call carries the remaining deadline budget
+// and goes through the upstream circuit breaker, except health checks, which
+// must see the upstream as it is.
+//
+// Methods are given as "/package.Service/Method". retryMethods are retried on
+// UNAVAILABLE, so they must be idempotent. cacheMethods are answered from the
+// last good reply while the circuit is open; a cached reply skips the
+// upstream's token check, so only methods whose answer does not depend on the
+// caller may be listed there.
+func Dial(name, address string, cfg config.GRPCClientConfig, retryMethods, cacheMethods []string) (*grpc.ClientConn, error) {
+	serviceConfig, err := buildServiceConfig(cfg, retryMethods)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up %s transport credentials: %w", name, err)
+	}
+
+	interceptors := []grpc.UnaryClientInterceptor{deadlineInterceptor}
+	if cfg.BreakerFailureThreshold > 0 {
+		b := newBreaker(name, cfg.BreakerFailureThreshold, cfg.BreakerOpenTimeout, cfg.BreakerHalfOpenRequests)
+		cache := newFallbackCache(cacheMethods, cfg.FallbackTTL, cfg.FallbackMaxEntries)
+		interceptors = append(interceptors, b.interceptor(cache))
+	}
+
+	conn, err := grpc.NewClient(address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  cfg.ConnectBaseDelay,
+				Multiplier: backoff.DefaultConfig.Multiplier,
+				Jitter:     backoff.DefaultConfig.Jitter,
+				MaxDelay:   cfg.ConnectMaxDelay,
+			},
+			MinConnectTimeout: cfg.ConnectTimeout,
+		}),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}),
+		grpc.WithChainUnaryInterceptor(interceptors...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection with %s: %w", address, err)
+	}
+
+	conn.Connect()
+	return conn, nil
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// isHealthCheck reports whether method is an upstream's HealthCheck RPC.
+func isHealthCheck(method string) bool {
+	return strings.HasSuffix(method, "/HealthCheck")
+}
+
+func buildServiceConfig(cfg config.GRPCClientConfig, retryMethods []string) (string, error) {
+	serviceConfig := struct {
+		MethodConfig []methodConfig `json:"methodConfig,omitempty"`
+	}{}
+
+	if cfg.RetryMaxAttempts > 1 && len(retryMethods) > 0 {
+		names := make([]methodName, 0, len(retryMethods))
+		for _, fullMethod := range retryMethods {
+			service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+			if !ok {
+				return "", fmt.Errorf("invalid gRPC method name %q", fullMethod)
+			}
+			names = append(names, methodName{Service: service, Method: method})
+		}
+
+		serviceConfig.MethodConfig = []methodConfig{{
+			Name: names,
+			RetryPolicy: &retryPolicy{
+				MaxAttempts:          cfg.RetryMaxAttempts,
+				InitialBackoff:       durationString(cfg.RetryInitialBackoff),
+				MaxBackoff:           durationString(cfg.RetryMaxBackoff),
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			},
+		}}
+	}
+
+	data, err := json.Marshal(serviceConfig)
+	return string(data), err
+}
+
+// durationString formats d the way gRPC service configs expect, e.g. "0.1s".
+func durationString(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
@@ -0,0 +1,98 @@
+package grpc_clients
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type cachedReply struct {
+	reply    proto.Message
+	storedAt time.Time
+}
+
+// fallbackCache keeps the last good reply of read methods, keyed by method
+// and request, to answer while the upstream circuit is open.
+type fallbackCache struct {
+	methods    map[string]bool
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cachedReply
+	order      []string
+	mu         sync.Mutex
+}
+
+func newFallbackCache(methods []string, ttl time.Duration, maxEntries int) *fallbackCache {
+	cache := &fallbackCache{
+		methods:    make(map[string]bool, len(methods)),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cachedReply),
+	}
+	for _, method := range methods {
+		cache.methods[method] = true
+	}
+	return cache
+}
+
+func (c *fallbackCache) key(method string, req interface{}) (string, bool) {
+	if c.ttl <= 0 || c.maxEntries <= 0 || !c.methods[method] {
+		return "", false
+	}
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", false
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", false
+	}
+	return method + "\x00" + string(data), true
+}
+
+func (c *fallbackCache) store(method string, req, reply interface{}) {
+	key, ok := c.key(method, req)
+	if !ok {
+		return
+	}
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists {
+		if len(c.order) >= c.maxEntries {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = cachedReply{reply: proto.Clone(msg), storedAt: time.Now()}
+}
+
+func (c *fallbackCache) load(method string, req, reply interface{}) bool {
+	key, ok := c.key(method, req)
+	if !ok {
+		return false
+	}
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	cached, exists := c.entries[key]
+	c.mu.Unlock()
+
+	if !exists || time.Since(cached.storedAt) > c.ttl {
+		return false
+	}
+
+	proto.Reset(msg)
+	proto.Merge(msg, cached.reply)
+	return true
+}
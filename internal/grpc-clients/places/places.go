@@ -1,48 +1,28 @@
 package grpc_clients
 
 import (
-	"context"
-	"fmt"
-	"time"
-
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	grpcclients "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-func SetupPlacesClient(address string) (proto.PlacesServiceClient, error) {
-	// log.Debug("Attempting to create gRPC connection", slog.String("address", address))
-
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		// log.Error("Failed to create gRPC connection", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("failed to create gRPC connection with places service: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			_ = conn.Close()
-			// log.Info("Closed gRPC connection due to error", slog.String("address", address))
-		}
-	}()
-
-	placesClient := proto.NewPlacesServiceClient(conn)
+var retryMethods = []string{
+	proto.PlacesService_GetPlaces_FullMethodName,
+	proto.PlacesService_GetCategories_FullMethodName,
+	proto.PlacesService_GetTickets_FullMethodName,
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+var cacheMethods = []string{
+	proto.PlacesService_GetPlaces_FullMethodName,
+	proto.PlacesService_GetCategories_FullMethodName,
+}
 
-	// log.Debug("Performing health check on places service", slog.String("address", address))
-	healthResponse, err := placesClient.HealthCheck(ctx, &proto.HealthCheckRequest{})
+func SetupPlacesClient(address string, cfg config.GRPCClientConfig) (proto.PlacesServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpcclients.Dial("places", address, cfg, retryMethods, cacheMethods)
 	if err != nil {
-		// log.Error("Health check failed", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("health check failed: %w", err)
-	}
-
-	if !healthResponse.IsHealthy {
-		err = fmt.Errorf("places service is not healthy")
-		// log.Warn("Places service reported as unhealthy", slog.String("address", address))
-		return nil, err
+		return nil, nil, err
 	}
 
-	// log.Info("Successfully connected to places service", slog.String("address", address))
-	return placesClient, nil
+	return proto.NewPlacesServiceClient(conn), conn, nil
 }
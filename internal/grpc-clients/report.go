@@ -0,0 +1,87 @@
+package grpc_clients
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type reportKey struct{}
+
+// CallReport collects what the resilience layer did during one HTTP request,
+// so the response can be adjusted after the handler ran.
+type CallReport struct {
+	open       bool
+	stale      bool
+	timedOut   bool
+	retryAfter time.Duration
+	mu         sync.Mutex
+}
+
+func WithCallReport(ctx context.Context) (context.Context, *CallReport) {
+	report := &CallReport{}
+	return context.WithValue(ctx, reportKey{}, report), report
+}
+
+func reportFrom(ctx context.Context) *CallReport {
+	report, _ := ctx.Value(reportKey{}).(*CallReport)
+	return report
+}
+
+// CircuitOpen reports whether a call was rejected by an open circuit and
+// when the upstream is worth retrying.
+func (r *CallReport) CircuitOpen() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.retryAfter, r.open
+}
+
+// Stale reports whether a cached fallback response was served.
+func (r *CallReport) Stale() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stale
+}
+
+// TimedOut reports whether a call ran out of its deadline.
+func (r *CallReport) TimedOut() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.timedOut
+}
+
+func (r *CallReport) markOpen(retryAfter time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.open = true
+	if retryAfter > r.retryAfter {
+		r.retryAfter = retryAfter
+	}
+}
+
+func (r *CallReport) markStale() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stale = true
+}
+
+func (r *CallReport) markTimedOut() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timedOut = true
+}
@@ -1,30 +1,21 @@
 package grpc_clients
 
 import (
-	"fmt"
-
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	grpcclients "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients"
 	proto "github.com/GP-Hacks/proto/pkg/api/user"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-func SetupUsersClient(address string) (proto.UserServiceClient, error) {
-	// log.Debug("Attempting to create gRPC connection", slog.String("address", address))
+var retryMethods = []string{
+	proto.UserService_GetMe_FullMethodName,
+}
 
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func SetupUsersClient(address string, cfg config.GRPCClientConfig) (proto.UserServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpcclients.Dial("users", address, cfg, retryMethods, nil)
 	if err != nil {
-		// log.Error("Failed to create gRPC connection", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("failed to create gRPC connection with charity service: %w", err)
+		return nil, nil, err
 	}
-	defer func() {
-		if err != nil {
-			_ = conn.Close()
-			// log.Info("Closed gRPC connection due to error", slog.String("address", address))
-		}
-	}()
-
-	charityClient := proto.NewUserServiceClient(conn)
 
-	// log.Info("Successfully connected to charity service", slog.String("address", address))
-	return charityClient, nil
+	return proto.NewUserServiceClient(conn), conn, nil
 }
@@ -1,48 +1,30 @@
 package grpc_clients
 
 import (
-	"context"
-	"fmt"
-	"time"
-
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	grpcclients "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-func SetupVotesClient(address string) (proto.VotesServiceClient, error) {
-	// log.Debug("Attempting to create gRPC connection", slog.String("address", address))
-
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		// log.Error("Failed to create gRPC connection", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("failed to create gRPC connection with votes service: %w", err)
-	}
-	defer func() {
-		if err != nil {
-			_ = conn.Close()
-			// log.Info("Closed gRPC connection due to error", slog.String("address", address))
-		}
-	}()
-
-	votesClient := proto.NewVotesServiceClient(conn)
+var retryMethods = []string{
+	proto.VotesService_GetVotes_FullMethodName,
+	proto.VotesService_GetCategories_FullMethodName,
+	proto.VotesService_GetRateInfo_FullMethodName,
+	proto.VotesService_GetPetitionInfo_FullMethodName,
+	proto.VotesService_GetChoiceInfo_FullMethodName,
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+var cacheMethods = []string{
+	proto.VotesService_GetVotes_FullMethodName,
+	proto.VotesService_GetCategories_FullMethodName,
+}
 
-	// log.Debug("Performing health check on votes service", slog.String("address", address))
-	healthResponse, err := votesClient.HealthCheck(ctx, &proto.HealthCheckRequest{})
+func SetupVotesClient(address string, cfg config.GRPCClientConfig) (proto.VotesServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpcclients.Dial("votes", address, cfg, retryMethods, cacheMethods)
 	if err != nil {
-		// log.Error("Health check failed", slog.String("address", address), slog.String("error", err.Error()))
-		return nil, fmt.Errorf("health check failed: %w", err)
-	}
-
-	if !healthResponse.IsHealthy {
-		err = fmt.Errorf("votes service is not healthy")
-		// log.Warn("Votes service reported as unhealthy", slog.String("address", address))
-		return nil, err
+		return nil, nil, err
 	}
 
-	// log.Info("Successfully connected to votes service", slog.String("address", address))
-	return votesClient, nil
+	return proto.NewVotesServiceClient(conn), conn, nil
 }
@@ -0,0 +1,145 @@
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusUnknown = "unknown"
+)
+
+type CheckFunc func(ctx context.Context) error
+
+type Status struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+}
+
+type check struct {
+	fn       CheckFunc
+	critical bool
+}
+
+// Checker runs dependency checks in the background and caches the results,
+// so probes never wait on upstream services.
+type Checker struct {
+	checks   map[string]check
+	statuses map[string]Status
+	interval time.Duration
+	timeout  time.Duration
+	draining atomic.Bool
+	mu       sync.RWMutex
+}
+
+func NewChecker(interval, timeout time.Duration) *Checker {
+	return &Checker{
+		checks:   make(map[string]check),
+		statuses: make(map[string]Status),
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Register adds a dependency. Critical dependencies make the gateway not
+// ready while they are down. Must be called before Start.
+func (c *Checker) Register(name string, critical bool, fn CheckFunc) {
+	c.checks[name] = check{fn: fn, critical: critical}
+	c.statuses[name] = Status{Status: StatusUnknown, Critical: critical}
+}
+
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			c.refresh(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (c *Checker) refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, chk := range c.checks {
+		wg.Add(1)
+		go func(name string, chk check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			started := time.Now()
+			err := chk.fn(checkCtx)
+			status := Status{
+				Status:    StatusUp,
+				Critical:  chk.critical,
+				CheckedAt: started.UTC(),
+				LatencyMs: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				status.Status = StatusDown
+				status.Error = err.Error()
+			}
+
+			c.mu.Lock()
+			previous := c.statuses[name]
+			c.statuses[name] = status
+			c.mu.Unlock()
+
+			if previous.Status != status.Status {
+				log.Info().Str("dependency", name).Str("status", status.Status).Str("error", status.Error).Msg("Dependency status changed")
+			}
+		}(name, chk)
+	}
+	wg.Wait()
+}
+
+// SetDraining makes the gateway report not ready, so load balancers stop
+// routing new traffic to it during shutdown.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+// Ready reports whether every critical dependency passed its last check.
+func (c *Checker) Ready() bool {
+	if c.draining.Load() {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, status := range c.statuses {
+		if status.Critical && status.Status != StatusUp {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Checker) Statuses() map[string]Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make(map[string]Status, len(c.statuses))
+	for name, status := range c.statuses {
+		statuses[name] = status
+	}
+	return statuses
+}
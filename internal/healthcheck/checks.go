@@ -0,0 +1,60 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// GRPCConn reports whether the connection is, or can become, ready. Idle
+// connections are asked to connect first.
+func GRPCConn(conn *grpc.ClientConn) CheckFunc {
+	return func(ctx context.Context) error {
+		for {
+			state := conn.GetState()
+			switch state {
+			case connectivity.Ready:
+				return nil
+			case connectivity.Idle:
+				conn.Connect()
+			case connectivity.Shutdown:
+				return errors.New("connection is shut down")
+			}
+
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("connection is %s", state)
+			}
+		}
+	}
+}
+
+// TCPReachable dials the host of rawURL.
+func TCPReachable(rawURL string) CheckFunc {
+	return func(ctx context.Context) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
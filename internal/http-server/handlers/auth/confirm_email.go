@@ -1,13 +1,22 @@
 package auth
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/GP-Hacks/kdt2024-gateway/internal/bruteforce"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
 	proto "github.com/GP-Hacks/proto/pkg/api/auth"
 	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func NewConfirmEmailPageHandler(authClient proto.AuthServiceClient) http.HandlerFunc {
+// NewConfirmEmailPageHandler caps the rejected confirmation tokens per IP in
+// guard, so tokens cannot be enumerated.
+func NewConfirmEmailPageHandler(authClient proto.AuthServiceClient, guard *bruteforce.Guard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -35,14 +44,39 @@ func NewConfirmEmailPageHandler(authClient proto.AuthServiceClient) http.Handler
 			return
 		}
 
+		key := "ip:" + utils.ClientIP(r)
+		attempt, err := guard.Begin(ctx, key)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to record confirmation attempt")
+		}
+		if attempt.Locked() {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(attempt.RetryAfter.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`
+   			<html>
+			<head><meta charset="utf-8"/></head>
+   			<body>
+   				<h1>Ошибка подтверждения email</h1>
+   				<p>Слишком много попыток подтверждения. Попробуйте позже</p>
+   			</body>
+   			</html>
+   		`))
+			return
+		}
+
 		req := &proto.ConfirmEmailRequest{
 			Token: token,
 		}
 
-		_, err := authClient.ConfirmEmail(ctx, req)
+		_, err = authClient.ConfirmEmail(ctx, req)
 
 		w.Header().Set("Content-Type", "text/html")
 
+		if err == nil || !rejectedToken(err) {
+			// Only rejected tokens stay counted as failures.
+			forgive(ctx, attempt)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(`
@@ -69,3 +103,13 @@ func NewConfirmEmailPageHandler(authClient proto.AuthServiceClient) http.Handler
    	`))
 	}
 }
+
+// rejectedToken reports whether the auth service refused the token itself
+// rather than failing to process it.
+func rejectedToken(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted, codes.Internal:
+		return false
+	}
+	return true
+}
@@ -1,10 +1,17 @@
 package auth
 
 import (
+	"context"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	common "github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/bruteforce"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
 	proto "github.com/GP-Hacks/proto/pkg/api/auth"
+	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -14,7 +21,11 @@ type signInReq struct {
 	Password string `json:"password"`
 }
 
-func NewSignInHandler(authClient proto.AuthServiceClient) http.HandlerFunc {
+// NewSignInHandler counts failed attempts per email and per IP in guard. Locked
+// out attempts are rejected before reaching the auth service, and once the
+// guard asks for it the verifier must accept the challenge token. A nil
+// verifier disables the challenge.
+func NewSignInHandler(authClient proto.AuthServiceClient, guard *bruteforce.Guard, verifier bruteforce.Verifier) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -31,12 +42,39 @@ func NewSignInHandler(authClient proto.AuthServiceClient) http.HandlerFunc {
 			return
 		}
 
+		keys := []string{
+			"email:" + strings.ToLower(strings.TrimSpace(reqJ.Email)),
+			"ip:" + utils.ClientIP(r),
+		}
+
+		attempt, err := guard.Begin(ctx, keys...)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to record sign in attempt")
+		}
+		if attempt.Locked() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(attempt.RetryAfter.Seconds()))))
+			common.WriteError(w, http.StatusTooManyRequests, "Too many failed sign in attempts")
+			return
+		}
+		if attempt.ChallengeRequired && verifier != nil {
+			if err := verifier.Verify(ctx, r.Header.Get(bruteforce.ChallengeHeader), utils.ClientIP(r)); err != nil {
+				forgive(ctx, attempt)
+				w.Header().Set("X-Challenge-Provider", verifier.Name())
+				common.WriteError(w, http.StatusPreconditionRequired, "Challenge verification required")
+				return
+			}
+		}
+
 		req := &proto.SignInRequest{
 			Email:    reqJ.Email,
 			Password: reqJ.Password,
 		}
 
 		resp, err := authClient.SignIn(ctx, req)
+		if code := status.Code(err); code != codes.NotFound && code != codes.Unauthenticated {
+			// Only rejected credentials stay counted as failures.
+			forgive(ctx, attempt)
+		}
 		if err != nil {
 			if status.Code(err) == codes.NotFound {
 				common.WriteError(w, http.StatusNotFound, "User not found")
@@ -51,6 +89,18 @@ func NewSignInHandler(authClient proto.AuthServiceClient) http.HandlerFunc {
 			return
 		}
 
+		// Only the email is cleared: a valid account must not reset the
+		// counter of an IP that is guessing other accounts.
+		if err := guard.Reset(ctx, keys[0]); err != nil {
+			log.Warn().Err(err).Msg("Failed to reset sign in failures")
+		}
+
 		common.WriteJSON(w, http.StatusOK, resp.Tokens)
 	}
 }
+
+func forgive(ctx context.Context, attempt *bruteforce.Attempt) {
+	if err := attempt.Forgive(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to forgive attempt")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	proto "github.com/GP-Hacks/proto/pkg/api/charity"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -32,8 +33,8 @@ func NewDonateHandler(charityClient proto.CharityServiceClient) http.HandlerFunc
 		default:
 		}
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Authorization header missing")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
 			return
@@ -63,7 +64,7 @@ func NewDonateHandler(charityClient proto.CharityServiceClient) http.HandlerFunc
 		}
 
 		protoRequest := &proto.DonateRequest{
-			Token:        token,
+			Token:        identity.Token,
 			CollectionId: int32(request.CollectionId),
 			Amount:       int32(request.Amount),
 		}
@@ -6,7 +6,7 @@ import (
 	"time"
 
 	"github.com/GP-Hacks/kdt2024-commons/json"
-	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	proto "github.com/GP-Hacks/proto/pkg/api/chat"
 )
 
@@ -38,8 +38,8 @@ func NewGetHistoryHandler(chatClient proto.ChatServiceClient) http.HandlerFunc {
 		default:
 		}
 
-		token, err := utils.GetTokenFromHeader(r)
-		if err != nil {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			json.WriteError(w, http.StatusUnauthorized, "Invalid authorization header")
 			return
 		}
@@ -60,7 +60,7 @@ func NewGetHistoryHandler(chatClient proto.ChatServiceClient) http.HandlerFunc {
 		}
 
 		res, err := chatClient.GetHistory(ctx, &proto.GetHistoryRequest{
-			Token:  token,
+			Token:  identity.Token,
 			Limit:  int64(limitI),
 			Offset: int64(offsetI),
 		})
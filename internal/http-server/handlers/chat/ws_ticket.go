@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"net/http"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	websocket "github.com/GP-Hacks/kdt2024-gateway/internal/web_socket"
+)
+
+func NewIssueTicketHandler(tickets *websocket.TicketIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		select {
+		case <-ctx.Done():
+			http.Error(w, "Request was cancelled", http.StatusRequestTimeout)
+			return
+		default:
+		}
+
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
+			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
+			return
+		}
+
+		ticket, expiresAt, err := tickets.Issue(identity.Token)
+		if err != nil {
+			json.WriteError(w, http.StatusInternalServerError, "Failed to issue ticket")
+			return
+		}
+
+		json.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"ticket":     ticket,
+			"expires_at": expiresAt,
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/healthcheck"
+)
+
+type Response struct {
+	Status       string                        `json:"status"`
+	Dependencies map[string]healthcheck.Status `json:"dependencies,omitempty"`
+}
+
+// NewLivenessHandler only reports that the process is serving requests;
+// upstream outages must not get the gateway restarted.
+func NewLivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.WriteJSON(w, http.StatusOK, Response{Status: healthcheck.StatusUp})
+	}
+}
+
+func NewReadinessHandler(checker *healthcheck.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := Response{Status: healthcheck.StatusUp, Dependencies: checker.Statuses()}
+		status := http.StatusOK
+		if !checker.Ready() {
+			response.Status = healthcheck.StatusDown
+			status = http.StatusServiceUnavailable
+		}
+
+		json.WriteJSON(w, status, response)
+	}
+}
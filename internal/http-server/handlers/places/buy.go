@@ -6,6 +6,7 @@ import (
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -33,8 +34,8 @@ func NewBuyTicketHandler(placesClient proto.PlacesServiceClient) http.HandlerFun
 		default:
 		}
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Authorization header is missing or empty")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
 			return
@@ -63,7 +64,7 @@ func NewBuyTicketHandler(placesClient proto.PlacesServiceClient) http.HandlerFun
 		}
 
 		protoRequest := &proto.BuyTicketRequest{
-			Token:     token,
+			Token:     identity.Token,
 			PlaceId:   int32(request.PlaceId),
 			Timestamp: timestamppb.New(request.Timestamp),
 		}
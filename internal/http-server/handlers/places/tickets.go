@@ -5,6 +5,7 @@ import (
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -39,14 +40,14 @@ func NewGetTicketsHandler(placesClient proto.PlacesServiceClient) http.HandlerFu
 		default:
 		}
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Authorization header is missing or empty")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
 			return
 		}
 
-		request := proto.GetTicketsRequest{Token: token}
+		request := proto.GetTicketsRequest{Token: identity.Token}
 
 		resp, err := placesClient.GetTickets(ctx, &request)
 		if err != nil {
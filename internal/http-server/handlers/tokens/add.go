@@ -4,11 +4,16 @@ import (
 	"net/http"
 
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+	"github.com/rs/zerolog/log"
 )
 
 type TokenRequest struct {
-	Token string `json:"token"`
+	Token      string `json:"token"`
+	Platform   string `json:"platform"`
+	AppVersion string `json:"app_version"`
+	Locale     string `json:"locale"`
 }
 
 func NewAddTokenHandler() http.HandlerFunc {
@@ -33,8 +38,8 @@ func NewAddTokenHandler() http.HandlerFunc {
 		default:
 		}
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Authorization header is missing")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
 			return
@@ -53,8 +58,24 @@ func NewAddTokenHandler() http.HandlerFunc {
 			return
 		}
 
-		userID := authHeader
-		err := storage.AddUserToken(userID, tokenReq.Token)
+		if tokenReq.Platform == "" {
+			// Older clients only send the token.
+			log.Info().Str("user_id", identity.UserID).Msg("Device token registered without platform")
+			tokenReq.Platform = storage.PlatformUnknown
+		} else if !storage.IsValidPlatform(tokenReq.Platform) {
+			// logger.Warn("Platform field is invalid", slog.String("platform", tokenReq.Platform))
+			json.WriteError(w, http.StatusBadRequest, "Invalid platform field")
+			return
+		}
+
+		userID := identity.UserID
+		err := storage.AddUserToken(storage.DeviceToken{
+			UserID:     userID,
+			Token:      tokenReq.Token,
+			Platform:   tokenReq.Platform,
+			AppVersion: tokenReq.AppVersion,
+			Locale:     tokenReq.Locale,
+		})
 		if err != nil {
 			// logger.Error("Failed to add token to storage", slog.String("error", err.Error()), slog.String("user_id", userID))
 			json.WriteError(w, http.StatusInternalServerError, "Failed to save token")
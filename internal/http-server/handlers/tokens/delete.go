@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"net/http"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+)
+
+func NewDeleteTokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		select {
+		case <-ctx.Done():
+			http.Error(w, "Request was cancelled", http.StatusRequestTimeout)
+			return
+		default:
+		}
+
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
+			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
+			return
+		}
+
+		var tokenReq TokenRequest
+		if err := json.ReadJSON(r, &tokenReq); err != nil {
+			json.WriteError(w, http.StatusBadRequest, "Invalid JSON input")
+			return
+		}
+
+		if tokenReq.Token == "" {
+			json.WriteError(w, http.StatusBadRequest, "Invalid token field")
+			return
+		}
+
+		deleted, err := storage.DeleteUserToken(identity.UserID, tokenReq.Token)
+		if err != nil {
+			json.WriteError(w, http.StatusInternalServerError, "Failed to delete token")
+			return
+		}
+		if !deleted {
+			json.WriteError(w, http.StatusNotFound, "Token not found")
+			return
+		}
+
+		json.WriteJSON(w, http.StatusOK, map[string]string{"response": "Token deleted successfully"})
+	}
+}
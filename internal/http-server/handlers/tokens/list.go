@@ -0,0 +1,38 @@
+package tokens
+
+import (
+	"net/http"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+)
+
+func NewListTokensHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		select {
+		case <-ctx.Done():
+			http.Error(w, "Request was cancelled", http.StatusRequestTimeout)
+			return
+		default:
+		}
+
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
+			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
+			return
+		}
+
+		devices, err := storage.ListUserTokens(identity.UserID)
+		if err != nil {
+			json.WriteError(w, http.StatusInternalServerError, "Failed to load tokens")
+			return
+		}
+
+		json.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"response": devices,
+		})
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"net/http"
 
 	common "github.com/GP-Hacks/kdt2024-commons/json"
-	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	proto "github.com/GP-Hacks/proto/pkg/api/user"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -22,14 +22,14 @@ func NewGetMeHandler(userClient proto.UserServiceClient) http.HandlerFunc {
 		default:
 		}
 
-		token, err := utils.GetTokenFromHeader(r)
-		if err != nil {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			common.WriteError(w, http.StatusUnauthorized, "Invalid authorization header")
 			return
 		}
 
 		req := &proto.GetMeRequest{
-			Token: token,
+			Token: identity.Token,
 		}
 
 		resp, err := userClient.GetMe(ctx, req)
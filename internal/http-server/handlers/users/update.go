@@ -6,7 +6,7 @@ import (
 	"time"
 
 	common "github.com/GP-Hacks/kdt2024-commons/json"
-	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	proto "github.com/GP-Hacks/proto/pkg/api/user"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -34,8 +34,8 @@ func NewUpdateHandler(userClient proto.UserServiceClient) http.HandlerFunc {
 		default:
 		}
 
-		token, err := utils.GetTokenFromHeader(r)
-		if err != nil {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			common.WriteError(w, http.StatusUnauthorized, "Invalid authorization header")
 			return
 		}
@@ -50,7 +50,7 @@ func NewUpdateHandler(userClient proto.UserServiceClient) http.HandlerFunc {
 		log.Print(reqJ)
 
 		req := &proto.UpdateUserRequest{
-			Token: token,
+			Token: identity.Token,
 			User: &proto.User{
 				Email:       reqJ.User.Email,
 				FirstName:   reqJ.User.FirstName,
@@ -62,7 +62,7 @@ func NewUpdateHandler(userClient proto.UserServiceClient) http.HandlerFunc {
 
 		log.Print(req)
 
-		_, err = userClient.Update(ctx, req)
+		_, err := userClient.Update(ctx, req)
 		if err != nil {
 			if status.Code(err) == codes.Unauthenticated {
 				common.WriteError(w, http.StatusUnauthorized, "Invalid token")
@@ -4,7 +4,7 @@ import (
 	"net/http"
 
 	common "github.com/GP-Hacks/kdt2024-commons/json"
-	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	proto "github.com/GP-Hacks/proto/pkg/api/user"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -25,8 +25,8 @@ func NewUploadAvatarHandler(userClient proto.UserServiceClient) http.HandlerFunc
 		default:
 		}
 
-		token, err := utils.GetTokenFromHeader(r)
-		if err != nil {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			common.WriteError(w, http.StatusUnauthorized, "Invalid authorization header")
 			return
 		}
@@ -39,7 +39,7 @@ func NewUploadAvatarHandler(userClient proto.UserServiceClient) http.HandlerFunc
 
 		req := &proto.UploadAvatarRequest{
 			Photo: reqJ.Photo,
-			Token: token,
+			Token: identity.Token,
 		}
 
 		resp, err := userClient.UploadAvatar(ctx, req)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -72,8 +73,8 @@ func NewVoteChoiceHandler(votesClient proto.VotesServiceClient) http.HandlerFunc
 		default:
 		}
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Missing Authorization header")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
 			return
@@ -98,7 +99,7 @@ func NewVoteChoiceHandler(votesClient proto.VotesServiceClient) http.HandlerFunc
 			return
 		}
 
-		request.Token = token
+		request.Token = identity.Token
 
 		_, err := votesClient.VoteChoice(ctx, &request)
 		if err != nil {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -154,7 +155,10 @@ func NewGetVoteInfoHandler(votesClient proto.VotesServiceClient) http.HandlerFun
 			}
 		}
 
-		token := r.Header.Get("Authorization")
+		var token string
+		if identity, ok := jwtauth.FromContext(ctx); ok {
+			token = identity.Token
+		}
 
 		if voteResp == nil {
 			// logger.Warn("Vote not found", slog.Int("vote_id", int(voteId)))
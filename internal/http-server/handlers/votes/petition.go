@@ -6,6 +6,7 @@ import (
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 )
 
 type GetPetitionInfoResponseWithDefault struct {
@@ -70,8 +71,8 @@ func NewVotePetitionHandler(votesClient proto.VotesServiceClient) http.HandlerFu
 		default:
 		}
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Missing authorization token")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization required")
 			return
@@ -96,7 +97,7 @@ func NewVotePetitionHandler(votesClient proto.VotesServiceClient) http.HandlerFu
 			return
 		}
 
-		request.Token = token
+		request.Token = identity.Token
 
 		resp, err := votesClient.VotePetition(ctx, &request)
 		if err != nil {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/GP-Hacks/kdt2024-commons/api/proto"
 	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 )
 
 type GetRateInfoResponseWithDefault struct {
@@ -65,8 +66,8 @@ func NewVoteRateHandler(votesClient proto.VotesServiceClient) http.HandlerFunc {
 		default:
 		}
 
-		token := r.Header.Get("Authorization")
-		if token == "" {
+		identity, ok := jwtauth.FromContext(ctx)
+		if !ok {
 			// logger.Warn("Authorization token is missing")
 			json.WriteError(w, http.StatusUnauthorized, "Authorization token is required")
 			return
@@ -91,7 +92,7 @@ func NewVoteRateHandler(votesClient proto.VotesServiceClient) http.HandlerFunc {
 			return
 		}
 
-		request.Token = token
+		request.Token = identity.Token
 
 		resp, err := votesClient.VoteRate(ctx, &request)
 		if err != nil {
@@ -0,0 +1,154 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const anyOrigin = "*"
+
+type Options struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// wildcard matches origins such as "https://*.example.com": any subdomain of
+// example.com over https, but not example.com itself.
+type wildcard struct {
+	prefix string
+	suffix string
+}
+
+func (w wildcard) match(origin string) bool {
+	if len(origin) <= len(w.prefix)+len(w.suffix) || !strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+		return false
+	}
+	sub := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+	return !strings.ContainsAny(sub, "/:@")
+}
+
+// Policy decides which cross-origin browser requests are allowed. The same
+// policy backs the HTTP middleware and the WebSocket origin check.
+type Policy struct {
+	any              bool
+	origins          map[string]bool
+	wildcards        []wildcard
+	methods          string
+	headers          string
+	exposed          string
+	allowCredentials bool
+	maxAge           string
+}
+
+func New(opts Options) *Policy {
+	p := &Policy{
+		origins:          make(map[string]bool),
+		methods:          strings.ToUpper(strings.Join(opts.AllowedMethods, ", ")),
+		headers:          strings.Join(opts.AllowedHeaders, ", "),
+		exposed:          strings.Join(opts.ExposedHeaders, ", "),
+		allowCredentials: opts.AllowCredentials,
+	}
+	if opts.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		switch {
+		case origin == "":
+		case origin == anyOrigin:
+			p.any = true
+		case strings.Count(origin, "*") == 1:
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			p.wildcards = append(p.wildcards, wildcard{prefix: prefix, suffix: suffix})
+		default:
+			p.origins[origin] = true
+		}
+	}
+
+	return p
+}
+
+// AllowOrigin reports whether the policy admits requests from origin.
+func (p *Policy) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if w.match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler answers preflight requests for every route and adds the CORS
+// headers to actual requests from allowed origins. It has to run before
+// routing and authentication, since preflights carry no credentials.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !p.AllowOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Any origin never comes with credentials: config.Load rejects the
+		// combination, and reflecting every origin with credentials would
+		// let any site make authenticated requests.
+		if p.any {
+			w.Header().Set("Access-Control-Allow-Origin", anyOrigin)
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if p.allowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if p.exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", p.exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", p.methods)
+		if p.headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", p.headers)
+		}
+		if p.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", p.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,198 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyAllowOrigin(t *testing.T) {
+	policy := New(Options{AllowedOrigins: []string{"https://app.example.com/", " https://*.example.org ", ""}})
+
+	tests := []struct {
+		name   string
+		policy *Policy
+		origin string
+		want   bool
+	}{
+		{name: "exact origin", policy: policy, origin: "https://app.example.com", want: true},
+		{name: "case insensitive", policy: policy, origin: "HTTPS://APP.EXAMPLE.COM", want: true},
+		{name: "other origin", policy: policy, origin: "https://evil.com"},
+		{name: "other scheme", policy: policy, origin: "http://app.example.com"},
+		{name: "wildcard subdomain", policy: policy, origin: "https://a.example.org", want: true},
+		{name: "wildcard nested subdomain", policy: policy, origin: "https://a.b.example.org", want: true},
+		{name: "wildcard bare domain", policy: policy, origin: "https://example.org"},
+		{name: "wildcard with port", policy: policy, origin: "https://a.example.org:8443"},
+		{name: "wildcard with userinfo", policy: policy, origin: "https://evil.com@a.example.org"},
+		{name: "suffix lookalike", policy: policy, origin: "https://evilexample.org"},
+		{name: "no origin", policy: policy},
+		{name: "any origin", policy: New(Options{AllowedOrigins: []string{"*"}}), origin: "https://evil.com", want: true},
+		{name: "no origins configured", policy: New(Options{}), origin: "https://app.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.AllowOrigin(tt.origin); got != tt.want {
+				t.Errorf("AllowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyHandler(t *testing.T) {
+	opts := Options{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"get", "post"},
+		AllowedHeaders:   []string{"Authorization"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	anyOpts := opts
+	anyOpts.AllowedOrigins = []string{"*"}
+	anyOpts.AllowCredentials = false
+
+	tests := []struct {
+		name        string
+		opts        Options
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantNext    bool
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "same origin request",
+			opts:       opts,
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "",
+			},
+		},
+		{
+			name:       "allowed request",
+			opts:       opts,
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "Retry-After",
+				"Access-Control-Allow-Methods":     "",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:       "disallowed request",
+			opts:       opts,
+			method:     http.MethodGet,
+			origin:     "https://evil.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:       "allowed preflight",
+			opts:       opts,
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			preflight:  true,
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Allow-Methods":  "GET, POST",
+				"Access-Control-Allow-Headers":  "Authorization",
+				"Access-Control-Max-Age":        "600",
+				"Access-Control-Expose-Headers": "",
+			},
+		},
+		{
+			name:       "disallowed preflight",
+			opts:       opts,
+			method:     http.MethodOptions,
+			origin:     "https://evil.com",
+			preflight:  true,
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:       "plain OPTIONS request",
+			opts:       opts,
+			method:     http.MethodOptions,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:       "any origin",
+			opts:       anyOpts,
+			method:     http.MethodGet,
+			origin:     "https://evil.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name: "any origin never allows credentials",
+			opts: Options{
+				AllowedOrigins:   []string{"*"},
+				AllowCredentials: true,
+			},
+			method:     http.MethodGet,
+			origin:     "https://evil.com",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			handler := New(tt.opts).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			req := httptest.NewRequest(tt.method, "/api/places", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next handler called = %v, want %v", called, tt.wantNext)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
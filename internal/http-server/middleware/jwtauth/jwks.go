@@ -0,0 +1,209 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const minJWKSRefetch = 30 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwks struct {
+	url       string
+	client    *http.Client
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	mu        sync.RWMutex
+	refetchMu sync.Mutex
+}
+
+func newJWKS(ctx context.Context, url string, refresh time.Duration) (*jwks, error) {
+	ks := &jwks{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]interface{}),
+	}
+	if err := ks.fetch(); err != nil {
+		return nil, err
+	}
+
+	if refresh > 0 {
+		go func() {
+			ticker := time.NewTicker(refresh)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := ks.fetch(); err != nil {
+						log.Warn().Err(err).Str("url", ks.url).Msg("Failed to refresh JWKS")
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	return ks, nil
+}
+
+func (ks *jwks) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	key, ok := ks.lookup(kid)
+	stale := time.Since(ks.fetchedAt) > minJWKSRefetch
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		return ks.refetch(kid)
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refetch reloads the key set for an unknown kid. Concurrent callers wait for
+// a single fetch and then find the key, or the fresh set, already in place.
+func (ks *jwks) refetch(kid string) (interface{}, error) {
+	ks.refetchMu.Lock()
+	defer ks.refetchMu.Unlock()
+
+	ks.mu.RLock()
+	key, ok := ks.lookup(kid)
+	stale := time.Since(ks.fetchedAt) > minJWKSRefetch
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := ks.fetch(); err != nil {
+		return nil, err
+	}
+
+	ks.mu.RLock()
+	key, ok = ks.lookup(kid)
+	ks.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (ks *jwks) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *jwks) fetch() error {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warn().Err(err).Str("kid", k.Kid).Msg("Skipping unsupported JWK")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key component: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,186 @@
+package jwtauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type ctxKey struct{}
+
+type Identity struct {
+	UserID    string
+	Token     string
+	ExpiresAt time.Time
+	Claims    jwt.MapClaims
+}
+
+type Authenticator struct {
+	parser      *jwt.Parser
+	lenient     *jwt.Parser
+	keyFunc     jwt.Keyfunc
+	userIDClaim string
+	issuer      string
+	audience    string
+}
+
+func New(ctx context.Context, cfg *config.Config) (*Authenticator, error) {
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+
+	var keyFunc jwt.Keyfunc
+	var methods []string
+	switch {
+	case cfg.JWKSURL != "":
+		ks, err := newJWKS(ctx, cfg.JWKSURL, cfg.JWKSRefresh)
+		if err != nil {
+			return nil, err
+		}
+		keyFunc = ks.keyFunc
+		methods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+	case cfg.JWTSecret != "":
+		secret := []byte(cfg.JWTSecret)
+		keyFunc = func(*jwt.Token) (interface{}, error) { return secret, nil }
+		methods = []string{"HS256", "HS384", "HS512"}
+	default:
+		return nil, fmt.Errorf("either JWT_JWKS_URL or JWT_SECRET must be set")
+	}
+
+	opts = append(opts, jwt.WithValidMethods(methods))
+
+	return &Authenticator{
+		parser:      jwt.NewParser(opts...),
+		lenient:     jwt.NewParser(jwt.WithValidMethods(methods), jwt.WithoutClaimsValidation()),
+		keyFunc:     keyFunc,
+		userIDClaim: cfg.JWTUserIDClaim,
+		issuer:      cfg.JWTIssuer,
+		audience:    cfg.JWTAudience,
+	}, nil
+}
+
+func (a *Authenticator) Authenticate(token string) (*Identity, error) {
+	return a.authenticate(a.parser, token)
+}
+
+// AuthenticateExpired accepts tokens that are valid apart from their expiry.
+// It is meant for offline maintenance jobs that have to attribute
+// long-expired tokens.
+func (a *Authenticator) AuthenticateExpired(token string) (*Identity, error) {
+	identity, err := a.authenticate(a.lenient, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lenient parser skips every claim check, not only the expiry.
+	if a.issuer != "" {
+		if issuer, _ := identity.Claims.GetIssuer(); issuer != a.issuer {
+			return nil, jwt.ErrTokenInvalidIssuer
+		}
+	}
+	if a.audience != "" {
+		audience, _ := identity.Claims.GetAudience()
+		if !slices.Contains(audience, a.audience) {
+			return nil, jwt.ErrTokenInvalidAudience
+		}
+	}
+	return identity, nil
+}
+
+func (a *Authenticator) authenticate(parser *jwt.Parser, token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(token, claims, a.keyFunc); err != nil {
+		return nil, err
+	}
+
+	userID, err := claimString(claims, a.userIDClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		UserID: userID,
+		Token:  token,
+		Claims: claims,
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		identity.ExpiresAt = exp.Time
+	}
+
+	return identity, nil
+}
+
+// Middleware rejects requests without a valid access token.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.fromRequest(r)
+		if err != nil {
+			unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// OptionalMiddleware attaches the identity when a token is present and
+// rejects only tokens that fail validation.
+func (a *Authenticator) OptionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity, err := a.fromRequest(r)
+		if err != nil {
+			unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+func (a *Authenticator) fromRequest(r *http.Request) (*Identity, error) {
+	token, err := utils.GetTokenFromHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return a.Authenticate(token)
+}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, identity)
+}
+
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(ctxKey{}).(*Identity)
+	return identity, ok
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	json.WriteError(w, http.StatusUnauthorized, "Invalid or missing access token")
+}
+
+func claimString(claims jwt.MapClaims, name string) (string, error) {
+	switch v := claims[name].(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case float64:
+		return strconv.FormatInt(int64(v), 10), nil
+	}
+	return "", fmt.Errorf("claim %q is missing or invalid", name)
+}
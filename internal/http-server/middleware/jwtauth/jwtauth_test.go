@@ -0,0 +1,388 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "secret"
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	a, err := New(context.Background(), &config.Config{
+		JWTSecret:      testSecret,
+		JWTIssuer:      "auth-service",
+		JWTAudience:    "gateway",
+		JWTUserIDClaim: "sub",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return a
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return signed
+}
+
+func validClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub": "42",
+		"iss": "auth-service",
+		"aud": "gateway",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestAuthenticate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	expired := time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name        string
+		token       func(t *testing.T) string
+		wantUserID  string
+		wantErr     bool
+		wantExpired bool
+	}{
+		{
+			name: "valid token",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(nil))
+			},
+			wantUserID: "42",
+		},
+		{
+			name: "numeric user id",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(jwt.MapClaims{"sub": 42}))
+			},
+			wantUserID: "42",
+		},
+		{
+			name: "bad signature",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte("other"), "", validClaims(nil))
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(jwt.MapClaims{"iss": "evil"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(jwt.MapClaims{"aud": "other"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing exp",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(jwt.MapClaims{"exp": nil}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(jwt.MapClaims{"exp": expired}))
+			},
+			wantErr:     true,
+			wantExpired: true,
+		},
+		{
+			name: "missing user id",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(jwt.MapClaims{"sub": nil}))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "asymmetric alg for a shared secret",
+			token:   func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, rsaKey, "", validClaims(nil)) },
+			wantErr: true,
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims(nil))
+			},
+			wantErr: true,
+		},
+	}
+
+	a := newTestAuthenticator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token(t)
+			identity, err := a.Authenticate(token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantExpired && !errors.Is(err, jwt.ErrTokenExpired) {
+				t.Errorf("Authenticate() error = %v, want %v", err, jwt.ErrTokenExpired)
+			}
+			if err != nil {
+				return
+			}
+			if identity.UserID != tt.wantUserID || identity.Token != token {
+				t.Errorf("Authenticate() = %+v, want user %q with the token", identity, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestAuthenticateExpired(t *testing.T) {
+	expired := time.Now().Add(-30 * 24 * time.Hour).Unix()
+	hs256 := func(key string, claims jwt.MapClaims) func(t *testing.T) string {
+		return func(t *testing.T) string { return sign(t, jwt.SigningMethodHS256, []byte(key), "", claims) }
+	}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr bool
+	}{
+		{name: "expired token", token: hs256(testSecret, validClaims(jwt.MapClaims{"exp": expired}))},
+		{name: "unexpired token", token: hs256(testSecret, validClaims(nil))},
+		{name: "bad signature", token: hs256("other", validClaims(jwt.MapClaims{"exp": expired})), wantErr: true},
+		{name: "wrong issuer", token: hs256(testSecret, validClaims(jwt.MapClaims{"exp": expired, "iss": "evil"})), wantErr: true},
+		{name: "missing issuer", token: hs256(testSecret, validClaims(jwt.MapClaims{"exp": expired, "iss": nil})), wantErr: true},
+		{name: "wrong audience", token: hs256(testSecret, validClaims(jwt.MapClaims{"exp": expired, "aud": "other"})), wantErr: true},
+		{name: "missing user id", token: hs256(testSecret, validClaims(jwt.MapClaims{"exp": expired, "sub": nil})), wantErr: true},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", validClaims(jwt.MapClaims{"exp": expired}))
+			},
+			wantErr: true,
+		},
+	}
+
+	a := newTestAuthenticator(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := a.AuthenticateExpired(tt.token(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AuthenticateExpired() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && identity.UserID != "42" {
+				t.Errorf("AuthenticateExpired() user = %q, want %q", identity.UserID, "42")
+			}
+		})
+	}
+}
+
+// jwksServer serves a key set that the test can change, counting fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+	mu      sync.Mutex
+	keys    []jwk
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...jwk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) jwk {
+	return jwk{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}
+}
+
+func TestJWKSKeyFunc(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	type step struct {
+		name        string
+		publish     []jwk
+		stale       bool
+		token       func(t *testing.T) string
+		wantErr     bool
+		wantFetches int32
+	}
+	rs256 := func(kid string, key *rsa.PrivateKey) func(t *testing.T) string {
+		return func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, key, kid, validClaims(nil)) }
+	}
+
+	steps := []step{
+		{name: "known kid", token: rs256("old", oldKey), wantFetches: 1},
+		{name: "unknown kid within the throttle", publish: []jwk{rsaJWK("old", oldKey), rsaJWK("new", newKey)}, token: rs256("new", newKey), wantErr: true, wantFetches: 1},
+		{name: "unknown kid after the throttle", stale: true, token: rs256("new", newKey), wantFetches: 2},
+		{name: "refetched set is in place", token: rs256("old", oldKey), wantFetches: 2},
+		{name: "still unknown kid right after a refetch", token: rs256("other", newKey), wantErr: true, wantFetches: 2},
+		{name: "still unknown kid after the throttle", stale: true, token: rs256("other", newKey), wantErr: true, wantFetches: 3},
+		{name: "key signed by another key under a known kid", token: rs256("old", newKey), wantErr: true, wantFetches: 3},
+		{
+			name:        "ec key",
+			publish:     []jwk{ecJWK("ec", ecKey)},
+			stale:       true,
+			token:       func(t *testing.T) string { return sign(t, jwt.SigningMethodES256, ecKey, "ec", validClaims(nil)) },
+			wantFetches: 4,
+		},
+		{
+			name: "hmac token signed with the public key material",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, []byte("ec"), "ec", validClaims(nil))
+			},
+			wantErr:     true,
+			wantFetches: 4,
+		},
+	}
+
+	server := newJWKSServer(t)
+	server.publish(rsaJWK("old", oldKey))
+	a, err := New(context.Background(), &config.Config{
+		JWKSURL:        server.URL,
+		JWTIssuer:      "auth-service",
+		JWTAudience:    "gateway",
+		JWTUserIDClaim: "sub",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ks, err := newJWKS(context.Background(), server.URL, 0)
+	if err != nil {
+		t.Fatalf("newJWKS() error = %v", err)
+	}
+	server.fetches.Store(1)
+	a.keyFunc = ks.keyFunc
+
+	for _, step := range steps {
+		if step.publish != nil {
+			server.publish(step.publish...)
+		}
+		if step.stale {
+			ks.mu.Lock()
+			ks.fetchedAt = time.Now().Add(-minJWKSRefetch - time.Second)
+			ks.mu.Unlock()
+		}
+
+		_, err := a.Authenticate(step.token(t))
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: Authenticate() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if got := server.fetches.Load(); got != step.wantFetches {
+			t.Fatalf("%s: %d JWKS fetches, want %d", step.name, got, step.wantFetches)
+		}
+	}
+}
+
+func TestJWKSConcurrentRefetch(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	server := newJWKSServer(t)
+	server.publish(rsaJWK("old", oldKey))
+	ks, err := newJWKS(context.Background(), server.URL, 0)
+	if err != nil {
+		t.Fatalf("newJWKS() error = %v", err)
+	}
+	server.publish(rsaJWK("old", oldKey), rsaJWK("new", newKey))
+	ks.fetchedAt = time.Now().Add(-minJWKSRefetch - time.Second)
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}))
+	token := sign(t, jwt.SigningMethodRS256, newKey, "new", validClaims(nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := parser.Parse(token, ks.keyFunc); err != nil {
+				t.Errorf("Parse() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := server.fetches.Load(); got != 2 {
+		t.Errorf("%d JWKS fetches, want 2", got)
+	}
+}
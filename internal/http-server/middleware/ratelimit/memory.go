@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time
+}
+
+// MemoryStore keeps the buckets in process. Each replica limits on its own,
+// so the effective limit grows with the number of replicas.
+type MemoryStore struct {
+	buckets map[string]*bucket
+	now     func() time.Time
+	mu      sync.Mutex
+	stop    chan struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, policy Policy) (Result, error) {
+	now := s.now()
+	rate := policy.refillRate()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updated: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := float64(now.Sub(b.updated).Milliseconds())
+	b.tokens = math.Min(float64(policy.Limit), b.tokens+elapsed*rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := resultFor(policy, allowed, b.tokens)
+	b.fullAt = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// cleanup drops buckets that have refilled completely, since a new bucket
+// behaves the same.
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := s.now()
+			s.mu.Lock()
+			for key, b := range s.buckets {
+				if now.After(b.fullAt) {
+					delete(s.buckets, key)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	close(s.stop)
+	return nil
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+const storeTimeout = 500 * time.Millisecond
+
+var (
+	throttledRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limited_requests_total",
+			Help: "Requests rejected by the rate limiter per policy",
+		},
+		[]string{"policy"},
+	)
+	storeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limit_store_errors_total",
+			Help: "Rate limiter store failures; requests are let through when the store fails",
+		},
+		[]string{"policy"},
+	)
+)
+
+// Metrics returns the collectors of the rate limiter.
+func Metrics() []prometheus.Collector {
+	return []prometheus.Collector{throttledRequests, storeErrors}
+}
+
+// Policy is a token bucket that holds Limit tokens and refills completely
+// over Period. A zero Limit disables the policy.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy reads a policy in the "<requests>/<period>" form, e.g. "10/1m".
+// An empty spec or "0" disables the policy.
+func ParsePolicy(name, spec string) (Policy, error) {
+	policy := Policy{Name: name}
+	if spec == "" || spec == "0" {
+		return policy, nil
+	}
+
+	limit, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return policy, fmt.Errorf("rate limit %s: expected <requests>/<period>, got %q", name, spec)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return policy, fmt.Errorf("rate limit %s: invalid request count %q", name, limit)
+	}
+	// The bucket refills per millisecond.
+	d, err := time.ParseDuration(period)
+	if err != nil || d < time.Millisecond {
+		return policy, fmt.Errorf("rate limit %s: invalid period %q", name, period)
+	}
+
+	policy.Limit = n
+	policy.Period = d
+	return policy, nil
+}
+
+// refillRate returns the number of tokens added per millisecond.
+func (p Policy) refillRate() float64 {
+	return float64(p.Limit) / float64(p.Period.Milliseconds())
+}
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+func resultFor(policy Policy, allowed bool, tokens float64) Result {
+	rate := policy.refillRate()
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(policy.Limit)-tokens)/rate) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1-tokens)/rate) * time.Millisecond
+	}
+	return result
+}
+
+// Store keeps the buckets. Take removes one token from the bucket under key
+// if there is one.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+	Close() error
+}
+
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+}
+
+func New(store Store, policies ...Policy) *Limiter {
+	l := &Limiter{store: store, policies: make(map[string]Policy, len(policies))}
+	for _, policy := range policies {
+		l.policies[policy.Name] = policy
+	}
+	return l
+}
+
+// Limit applies the named policy. Requests are keyed by the authenticated
+// user when the route is protected and by client IP otherwise, so it should
+// run after the authentication middleware.
+func (l *Limiter) Limit(name string) func(http.Handler) http.Handler {
+	policy, ok := l.policies[name]
+	if !ok || policy.Limit == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), storeTimeout)
+			result, err := l.store.Take(ctx, policy.Name+":"+clientKey(r), policy)
+			cancel()
+			if err != nil {
+				storeErrors.WithLabelValues(policy.Name).Inc()
+				log.Warn().Err(err).Str("policy", policy.Name).Msg("Rate limiter store failed, letting the request through")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policyHeader)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				throttledRequests.WithLabelValues(policy.Name).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				json.WriteError(w, http.StatusTooManyRequests, "Too many requests")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
+
+func clientKey(r *http.Request) string {
+	if identity, ok := jwtauth.FromContext(r.Context()); ok {
+		return "user:" + identity.UserID
+	}
+	return "ip:" + utils.ClientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/realip"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Policy
+		wantErr bool
+	}{
+		{name: "empty disables", spec: "", want: Policy{Name: "auth"}},
+		{name: "zero disables", spec: "0", want: Policy{Name: "auth"}},
+		{name: "per minute", spec: "10/1m", want: Policy{Name: "auth", Limit: 10, Period: time.Minute}},
+		{name: "per second", spec: "5/1s", want: Policy{Name: "auth", Limit: 5, Period: time.Second}},
+		{name: "zero requests", spec: "0/1m", want: Policy{Name: "auth", Period: time.Minute}},
+		{name: "missing period", spec: "10", wantErr: true},
+		{name: "bad count", spec: "ten/1m", wantErr: true},
+		{name: "negative count", spec: "-1/1m", wantErr: true},
+		{name: "bad period", spec: "10/minute", wantErr: true},
+		{name: "zero period", spec: "10/0s", wantErr: true},
+		{name: "negative period", spec: "10/-1m", wantErr: true},
+		{name: "sub-millisecond period", spec: "10/500us", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicy("auth", tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("ParsePolicy(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	policy := Policy{Name: "auth", Limit: 3, Period: 3 * time.Second}
+
+	type take struct {
+		key           string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+		wantRetry     time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "burst up to the limit",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+				{wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+				{wantAllowed: false, wantRemaining: 0, wantReset: 3 * time.Second, wantRetry: time.Second},
+			},
+		},
+		{
+			name: "partial refill",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+				{wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+				{advance: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantReset: 2500 * time.Millisecond, wantRetry: 500 * time.Millisecond},
+				{advance: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+			},
+		},
+		{
+			name: "refill is capped at the limit",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{advance: time.Hour, wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+			},
+		},
+		{
+			name: "keys have separate buckets",
+			takes: []take{
+				{key: "a", wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{key: "a", wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+				{key: "b", wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			defer store.Close()
+			now := time.Unix(1700000000, 0)
+			store.now = func() time.Time { return now }
+
+			for i, step := range tt.takes {
+				now = now.Add(step.advance)
+				key := step.key
+				if key == "" {
+					key = "ip:203.0.113.7"
+				}
+
+				got, err := store.Take(context.Background(), key, policy)
+				if err != nil {
+					t.Fatalf("take %d: error = %v", i, err)
+				}
+				want := Result{Allowed: step.wantAllowed, Remaining: step.wantRemaining, Reset: step.wantReset, RetryAfter: step.wantRetry}
+				if got != want {
+					t.Errorf("take %d: Take() = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Policy) (Result, error) {
+	return Result{}, errors.New("store unavailable")
+}
+
+func (failingStore) Close() error { return nil }
+
+func TestLimiterLimit(t *testing.T) {
+	policy := Policy{Name: "auth", Limit: 2, Period: time.Minute}
+
+	type request struct {
+		forwardedFor string
+		userID       string
+		wantStatus   int
+		wantHeaders  map[string]string
+	}
+
+	allowed := func(remaining, reset string) map[string]string {
+		return map[string]string{
+			"RateLimit-Policy":    "2;w=60",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": remaining,
+			"RateLimit-Reset":     reset,
+			"Retry-After":         "",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		store    Store
+		policy   string
+		requests []request
+	}{
+		{
+			name:   "throttled after the limit",
+			policy: "auth",
+			requests: []request{
+				{wantStatus: http.StatusOK, wantHeaders: allowed("1", "30")},
+				{wantStatus: http.StatusOK, wantHeaders: allowed("0", "60")},
+				{
+					wantStatus: http.StatusTooManyRequests,
+					wantHeaders: map[string]string{
+						"RateLimit-Remaining": "0",
+						"Retry-After":         "30",
+					},
+				},
+			},
+		},
+		{
+			name:   "spoofed forwarding header keeps the peer bucket",
+			policy: "auth",
+			requests: []request{
+				{forwardedFor: "198.51.100.1", wantStatus: http.StatusOK},
+				{forwardedFor: "198.51.100.2", wantStatus: http.StatusOK},
+				{forwardedFor: "198.51.100.3", wantStatus: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:   "users have their own buckets",
+			policy: "auth",
+			requests: []request{
+				{userID: "1", wantStatus: http.StatusOK},
+				{userID: "1", wantStatus: http.StatusOK},
+				{userID: "1", wantStatus: http.StatusTooManyRequests},
+				{userID: "2", wantStatus: http.StatusOK, wantHeaders: allowed("1", "30")},
+			},
+		},
+		{
+			name:   "unknown policy is not limited",
+			policy: "payment",
+			requests: []request{
+				{wantStatus: http.StatusOK},
+				{wantStatus: http.StatusOK},
+				{wantStatus: http.StatusOK, wantHeaders: map[string]string{"RateLimit-Limit": ""}},
+			},
+		},
+		{
+			name:   "store failure lets requests through",
+			store:  failingStore{},
+			policy: "auth",
+			requests: []request{
+				{wantStatus: http.StatusOK, wantHeaders: map[string]string{"RateLimit-Limit": ""}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if store == nil {
+				memory := NewMemoryStore()
+				now := time.Unix(1700000000, 0)
+				memory.now = func() time.Time { return now }
+				store = memory
+			}
+			limiter := New(store, policy)
+			defer limiter.Close()
+
+			resolver, err := realip.New(nil)
+			if err != nil {
+				t.Fatalf("realip.New() error = %v", err)
+			}
+			handler := resolver.Handler(limiter.Limit(tt.policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			for i, step := range tt.requests {
+				req := httptest.NewRequest(http.MethodPost, "/api/auth/sign_in", nil)
+				req.RemoteAddr = "203.0.113.7:5000"
+				if step.forwardedFor != "" {
+					req.Header.Set("X-Forwarded-For", step.forwardedFor)
+				}
+				if step.userID != "" {
+					req = req.WithContext(jwtauth.WithIdentity(req.Context(), &jwtauth.Identity{UserID: step.userID}))
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != step.wantStatus {
+					t.Errorf("request %d: status = %d, want %d", i, rec.Code, step.wantStatus)
+				}
+				for name, want := range step.wantHeaders {
+					if got := rec.Header().Get(name); got != want {
+						t.Errorf("request %d: %s = %q, want %q", i, name, got, want)
+					}
+				}
+			}
+		})
+	}
+}
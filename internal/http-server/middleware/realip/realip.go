@@ -0,0 +1,106 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver rewrites RemoteAddr to the client address. X-Forwarded-For and
+// X-Real-IP are only honoured on requests from a trusted proxy: anyone else
+// could pick the address that rate limits and sign-in lockouts are keyed on.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New accepts trusted proxies as CIDRs or single addresses. Without any, the
+// forwarding headers are ignored and the peer address is used as is.
+func New(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			r.trusted = append(r.trusted, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return r, nil
+}
+
+func (res *Resolver) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := res.clientIP(r); ok {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP walks X-Forwarded-For from the right, skipping trusted proxies;
+// the first address they did not add themselves is the client.
+func (res *Resolver) clientIP(r *http.Request) (string, bool) {
+	peer, ok := parseAddr(r.RemoteAddr)
+	if !ok || !res.isTrusted(peer) {
+		return "", false
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, ok := parseAddr(hops[i])
+			if !ok {
+				break
+			}
+			client = hop
+			if !res.isTrusted(hop) {
+				break
+			}
+		}
+		return client.String(), true
+	}
+
+	if realIP, ok := parseAddr(r.Header.Get("X-Real-IP")); ok {
+		return realIP.String(), true
+	}
+	return "", false
+}
+
+func (res *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr accepts a bare address or host:port.
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
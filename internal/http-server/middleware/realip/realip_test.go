@@ -0,0 +1,115 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+)
+
+func TestResolverHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "no proxies trusted",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed header from untrusted peer",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed entry before the proxy chain",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.3"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "only trusted hops",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"},
+			want:       "10.0.0.4",
+		},
+		{
+			name:       "malformed hop",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, bogus"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "real ip from trusted proxy",
+			trusted:    []string{"10.0.0.2"},
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "real ip from untrusted peer",
+			trusted:    []string{"10.0.0.2"},
+			remoteAddr: "10.0.0.3:5000",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.7"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "ipv6 proxy",
+			trusted:    []string{"fd00::/8"},
+			remoteAddr: "[fd00::1]:5000",
+			headers:    map[string]string{"X-Forwarded-For": "2001:db8::7"},
+			want:       "2001:db8::7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := New(tt.trusted)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			var got string
+			handler := resolver.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = utils.ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/sign_in", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0"} {
+		if _, err := New([]string{proxy}); err == nil {
+			t.Errorf("New(%q) error = nil, want an error", proxy)
+		}
+	}
+}
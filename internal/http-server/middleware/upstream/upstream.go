@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	grpcclients "github.com/GP-Hacks/kdt2024-gateway/internal/grpc-clients"
+)
+
+// writeGrace leaves the handler time to report a timeout after the deadline.
+const writeGrace = time.Second
+
+// Middleware turns upstream calls rejected by an open circuit breaker into
+// 503 responses with Retry-After and calls that ran out of their deadline
+// into 504, and marks responses built from cached fallbacks as stale.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, report := grpcclients.WithCallReport(r.Context())
+		next.ServeHTTP(&responseWriter{ResponseWriter: w, report: report}, r.WithContext(ctx))
+	})
+}
+
+// Timeout bounds the time a route may spend on upstream calls. The connection
+// deadlines follow the route timeout, so slow routes such as uploads are not
+// cut off by the server-wide timeouts.
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			deadline, _ := ctx.Deadline()
+			rc := http.NewResponseController(w)
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline.Add(writeGrace))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	report      *grpcclients.CallReport
+	wroteHeader bool
+	suppressed  bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+
+	if status >= http.StatusBadRequest {
+		if retryAfter, open := rw.report.CircuitOpen(); open {
+			// The handler's own error is less useful to the client than
+			// knowing the upstream is down and when to come back.
+			rw.suppressed = true
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			json.WriteError(rw.ResponseWriter, http.StatusServiceUnavailable, "Upstream service is temporarily unavailable")
+			return
+		}
+		if rw.report.TimedOut() {
+			rw.suppressed = true
+			json.WriteError(rw.ResponseWriter, http.StatusGatewayTimeout, "Upstream service did not respond in time")
+			return
+		}
+	}
+	if rw.report.Stale() {
+		rw.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.suppressed {
+		return len(b), nil
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack keeps WebSocket upgrades working behind the middleware.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
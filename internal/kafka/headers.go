@@ -0,0 +1,27 @@
+package kafka
+
+import "github.com/IBM/sarama"
+
+const (
+	HeaderCorrelationID = "correlation-id"
+	HeaderReplyTo       = "reply-to"
+	HeaderInstanceID    = "gateway-instance-id"
+	HeaderDeadline      = "deadline"
+	HeaderSchemaVersion = "schema-version"
+	HeaderFrameType     = "frame-type"
+
+	SchemaVersion = "1"
+)
+
+func stringHeader(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+}
+
+func headerValue(msg *sarama.ConsumerMessage, key string) (string, bool) {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTransportClosed = errors.New("chat transport is closed")
+
+// ChatHandler plays the chat service for MemoryTransport: it answers one
+// request by calling reply for every frame, ending with a final or error one.
+type ChatHandler func(ctx context.Context, requestMsg RequestMessage, reply func(ResponseChunk))
+
+// MemoryTransport delivers chat requests to an in-process handler instead of
+// Kafka, so the chat flow runs without a broker.
+type MemoryTransport struct {
+	streamRegistry
+	handler ChatHandler
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewMemoryTransport(handler ChatHandler) *MemoryTransport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryTransport{
+		streamRegistry: newStreamRegistry(),
+		handler:        handler,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+func (t *MemoryTransport) Start(context.Context) error {
+	return nil
+}
+
+func (t *MemoryTransport) SendMessage(uuid string, requestMsg RequestMessage, timeout time.Duration) error {
+	if t.ctx.Err() != nil {
+		return ErrTransportClosed
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ctx, cancel := context.WithTimeout(t.ctx, timeout)
+		defer cancel()
+
+		t.handler(ctx, requestMsg, func(chunk ResponseChunk) {
+			t.streamRegistry.deliver(uuid, chunk)
+		})
+	}()
+
+	return nil
+}
+
+func (t *MemoryTransport) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// EchoHandler answers every request with its own content. It is meant for
+// running the gateway locally without the chat service.
+func EchoHandler(_ context.Context, requestMsg RequestMessage, reply func(ResponseChunk)) {
+	payload, _ := json.Marshal(SuccessResponse{
+		Status:    "success",
+		Content:   requestMsg.Content,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	reply(ResponseChunk{Frame: FrameFinal, Payload: payload})
+}
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryTransportStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    ChatHandler
+		wantChunks []ResponseChunk
+		wantErr    bool
+	}{
+		{
+			name: "single final frame",
+			handler: func(_ context.Context, requestMsg RequestMessage, reply func(ResponseChunk)) {
+				reply(ResponseChunk{Frame: FrameFinal, Payload: []byte(requestMsg.Content)})
+			},
+			wantChunks: []ResponseChunk{{Frame: FrameFinal, Payload: []byte("hello")}},
+		},
+		{
+			name: "partial frames in order",
+			handler: func(_ context.Context, _ RequestMessage, reply func(ResponseChunk)) {
+				reply(ResponseChunk{Frame: FramePartial, Payload: []byte("a")})
+				reply(ResponseChunk{Frame: FramePartial, Payload: []byte("b")})
+				reply(ResponseChunk{Frame: FrameFinal, Payload: []byte("c")})
+			},
+			wantChunks: []ResponseChunk{
+				{Frame: FramePartial, Payload: []byte("a")},
+				{Frame: FramePartial, Payload: []byte("b")},
+				{Frame: FrameFinal, Payload: []byte("c")},
+			},
+		},
+		{
+			name: "error frame ends the stream",
+			handler: func(_ context.Context, _ RequestMessage, reply func(ResponseChunk)) {
+				reply(ResponseChunk{Frame: FrameError, Payload: []byte("boom")})
+				reply(ResponseChunk{Frame: FrameFinal, Payload: []byte("ignored")})
+			},
+			wantChunks: []ResponseChunk{{Frame: FrameError, Payload: []byte("boom")}},
+		},
+		{
+			name:    "no reply times out",
+			handler: func(context.Context, RequestMessage, func(ResponseChunk)) {},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewMemoryTransport(tt.handler)
+			defer transport.Close()
+
+			stream := transport.OpenStream("uuid")
+			defer stream.Close()
+
+			if err := transport.SendMessage("uuid", RequestMessage{Content: "hello"}, time.Second); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+
+			var chunks []ResponseChunk
+			for {
+				chunk, err := stream.Next(context.Background(), 50*time.Millisecond)
+				if err != nil {
+					if !tt.wantErr {
+						t.Fatalf("Next() error = %v", err)
+					}
+					break
+				}
+				chunks = append(chunks, chunk)
+				if chunk.Done() {
+					break
+				}
+			}
+
+			if !reflect.DeepEqual(chunks, tt.wantChunks) {
+				t.Errorf("chunks = %v, want %v", chunks, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestMemoryTransportEcho(t *testing.T) {
+	transport := NewMemoryTransport(EchoHandler)
+	defer transport.Close()
+
+	stream := transport.OpenStream("uuid")
+	defer stream.Close()
+
+	if err := transport.SendMessage("uuid", RequestMessage{Content: "hello"}, time.Second); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	chunk, err := stream.Next(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	var response SuccessResponse
+	if err := json.Unmarshal(chunk.Payload, &response); err != nil {
+		t.Fatalf("payload is not a SuccessResponse: %v", err)
+	}
+	if chunk.Frame != FrameFinal || response.Content != "hello" {
+		t.Errorf("got %s frame with %q, want final frame with %q", chunk.Frame, response.Content, "hello")
+	}
+}
+
+func TestMemoryTransportOverflow(t *testing.T) {
+	replied := make(chan struct{})
+	transport := NewMemoryTransport(func(_ context.Context, _ RequestMessage, reply func(ResponseChunk)) {
+		defer close(replied)
+		for i := 0; i <= streamBuffer; i++ {
+			reply(ResponseChunk{Frame: FramePartial})
+		}
+	})
+	defer transport.Close()
+
+	stream := transport.OpenStream("uuid")
+	defer stream.Close()
+
+	if err := transport.SendMessage("uuid", RequestMessage{}, time.Second); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	<-replied
+
+	if _, err := stream.Next(context.Background(), time.Second); !errors.Is(err, ErrStreamOverflow) {
+		t.Errorf("Next() error = %v, want %v", err, ErrStreamOverflow)
+	}
+}
+
+func TestMemoryTransportClosed(t *testing.T) {
+	transport := NewMemoryTransport(EchoHandler)
+	transport.Close()
+
+	if err := transport.SendMessage("uuid", RequestMessage{}, time.Second); !errors.Is(err, ErrTransportClosed) {
+		t.Errorf("SendMessage() error = %v, want %v", err, ErrTransportClosed)
+	}
+}
+
+func TestStreamCloseTwice(t *testing.T) {
+	transport := NewMemoryTransport(EchoHandler)
+	defer transport.Close()
+
+	stream := transport.OpenStream("uuid")
+	stream.Close()
+	stream.Close()
+}
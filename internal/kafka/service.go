@@ -3,22 +3,30 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
 	"github.com/IBM/sarama"
 )
 
 type KafkaService struct {
-	producer        sarama.SyncProducer
-	consumer        sarama.Consumer
-	requestTopic    string
-	responseTopic   string
-	pendingRequests map[string]chan []byte
-	mu              sync.RWMutex
+	streamRegistry
+	producer     sarama.SyncProducer
+	group        sarama.ConsumerGroup
+	admin        sarama.ClusterAdmin
+	requestTopic string
+	replyTopic   string
+	instanceID   string
+	consuming    atomic.Bool
+	ready        chan struct{}
+	readyOnce    sync.Once
 }
 
 type RequestMessage struct {
@@ -42,28 +50,72 @@ func NewKafkaService(config *config.Config) (*KafkaService, error) {
 	kafkfaCfg := sarama.NewConfig()
 	kafkfaCfg.Producer.Return.Successes = true
 	kafkfaCfg.Consumer.Return.Errors = true
+	// Every instance starts a fresh reply group: with OffsetNewest, replies
+	// written before the first partition assignment would be lost.
+	kafkfaCfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	kafkfaCfg.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+
+	// Each gateway instance listens on its own reply topic, so a chat service
+	// reply only reaches the replica waiting for it. The topic is deleted in
+	// Close; after a crash it stays and is reused by the instance with the
+	// same GATEWAY_INSTANCE_ID. With random pod names, orphaned topics have to
+	// be deleted by hand (kafka-topics --delete), and their size is bounded by
+	// KAFKA_REPLY_TOPIC_RETENTION.
+	replyTopic := fmt.Sprintf("%s.%s", config.ResponseTopic, config.InstanceID)
+
+	admin, err := sarama.NewClusterAdmin(config.KafkaBrokers, kafkfaCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed create cluster admin: %v", err)
+	}
+
+	// Reply chunks carry no sequence numbers, so only a single partition
+	// keeps the partial and final frames in order.
+	retention := strconv.FormatInt(config.ReplyRetention.Milliseconds(), 10)
+	err = admin.CreateTopic(replyTopic, &sarama.TopicDetail{
+		NumPartitions:     1,
+		ReplicationFactor: int16(config.ReplyReplication),
+		ConfigEntries:     map[string]*string{"retention.ms": &retention},
+	}, false)
+	if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		admin.Close()
+		return nil, fmt.Errorf("failed create reply topic: %v", err)
+	}
 
 	producer, err := sarama.NewSyncProducer(config.KafkaBrokers, kafkfaCfg)
 	if err != nil {
+		admin.Close()
 		return nil, fmt.Errorf("failed create producer: %v", err)
 	}
 
-	consumer, err := sarama.NewConsumer(config.KafkaBrokers, kafkfaCfg)
+	group, err := sarama.NewConsumerGroup(config.KafkaBrokers, "gateway-replies-"+config.InstanceID, kafkfaCfg)
 	if err != nil {
 		producer.Close()
-		return nil, fmt.Errorf("failed create consumer: %v", err)
+		admin.Close()
+		return nil, fmt.Errorf("failed create consumer group: %v", err)
 	}
 
 	return &KafkaService{
-		producer:        producer,
-		consumer:        consumer,
-		requestTopic:    config.RequestTopic,
-		responseTopic:   config.ResponseTopic,
-		pendingRequests: make(map[string]chan []byte),
+		streamRegistry: newStreamRegistry(),
+		producer:       producer,
+		group:          group,
+		admin:          admin,
+		requestTopic:   config.RequestTopic,
+		replyTopic:     replyTopic,
+		instanceID:     config.InstanceID,
+		ready:          make(chan struct{}),
 	}, nil
 }
 
-func (ks *KafkaService) SendMessage(uuid string, requestMsg RequestMessage) error {
+func (ks *KafkaService) SendMessage(uuid string, requestMsg RequestMessage, timeout time.Duration) error {
+	// Without an active reply consumer the request could go unanswered.
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ks.ready:
+	case <-timer.C:
+		return errors.New("reply consumer is not ready")
+	}
+
 	msgBytes, err := json.Marshal(requestMsg)
 	if err != nil {
 		return fmt.Errorf("failed serialize message: %v", err)
@@ -73,6 +125,13 @@ func (ks *KafkaService) SendMessage(uuid string, requestMsg RequestMessage) erro
 		Topic: ks.requestTopic,
 		Key:   sarama.StringEncoder(uuid),
 		Value: sarama.ByteEncoder(msgBytes),
+		Headers: []sarama.RecordHeader{
+			stringHeader(HeaderCorrelationID, uuid),
+			stringHeader(HeaderReplyTo, ks.replyTopic),
+			stringHeader(HeaderInstanceID, ks.instanceID),
+			stringHeader(HeaderDeadline, time.Now().Add(timeout).UTC().Format(time.RFC3339Nano)),
+			stringHeader(HeaderSchemaVersion, SchemaVersion),
+		},
 	}
 
 	_, _, err = ks.producer.SendMessage(kafkaMsg)
@@ -83,65 +142,92 @@ func (ks *KafkaService) SendMessage(uuid string, requestMsg RequestMessage) erro
 	return nil
 }
 
-func (ks *KafkaService) WaitForResponse(uuid string, timeout time.Duration) ([]byte, error) {
-	responseChan := make(chan []byte, 1)
-
-	ks.mu.Lock()
-	ks.pendingRequests[uuid] = responseChan
-	ks.mu.Unlock()
+func (ks *KafkaService) Start(ctx context.Context) error {
+	go func() {
+		for err := range ks.group.Errors() {
+			log.Printf("Ошибка консьюмера: %v", err)
+		}
+	}()
 
-	defer func() {
-		ks.mu.Lock()
-		delete(ks.pendingRequests, uuid)
-		ks.mu.Unlock()
-		close(responseChan)
+	go func() {
+		utils.RunConsumerGroup(ctx, ks.group, []string{ks.replyTopic}, ks, "chat replies")
+		log.Println("Остановка консьюмера ответов")
 	}()
 
-	select {
-	case response := <-responseChan:
-		return response, nil
-	case <-time.After(timeout):
-		return nil, fmt.Errorf("ttl for UUID: %s", uuid)
+	return nil
+}
+
+func (ks *KafkaService) Setup(session sarama.ConsumerGroupSession) error {
+	ks.consuming.Store(true)
+	ks.readyOnce.Do(func() { close(ks.ready) })
+	log.Printf("Назначены партиции топика ответов: %v", session.Claims()[ks.replyTopic])
+	return nil
+}
+
+func (ks *KafkaService) Cleanup(session sarama.ConsumerGroupSession) error {
+	ks.consuming.Store(false)
+	log.Printf("Освобождены партиции топика ответов: %v", session.Claims()[ks.replyTopic])
+	return nil
+}
+
+func (ks *KafkaService) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			ks.deliver(msg)
+			session.MarkMessage(msg, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
 	}
 }
 
-func (ks *KafkaService) StartResponseConsumer(ctx context.Context) error {
-	partitionConsumer, err := ks.consumer.ConsumePartition(ks.responseTopic, 0, sarama.OffsetNewest)
-	if err != nil {
-		return fmt.Errorf("ошибка создания partition consumer: %v", err)
+func (ks *KafkaService) deliver(msg *sarama.ConsumerMessage) {
+	if instanceID, ok := headerValue(msg, HeaderInstanceID); ok && instanceID != ks.instanceID {
+		log.Printf("Ответ адресован другому инстансу: %s", instanceID)
+		return
 	}
 
+	// The message key remains a fallback for older chat service versions.
+	messageUUID, ok := headerValue(msg, HeaderCorrelationID)
+	if !ok {
+		messageUUID = string(msg.Key)
+	}
+
+	// Replies without a frame-type header are final, as in the original protocol.
+	frame, ok := headerValue(msg, HeaderFrameType)
+	if !ok {
+		frame = FrameFinal
+	}
+
+	ks.streamRegistry.deliver(messageUUID, ResponseChunk{Frame: frame, Payload: msg.Value})
+}
+
+// ProducerHealth checks that the brokers answer metadata requests.
+func (ks *KafkaService) ProducerHealth(ctx context.Context) error {
+	done := make(chan error, 1)
 	go func() {
-		defer partitionConsumer.Close()
-
-		for {
-			select {
-			case msg := <-partitionConsumer.Messages():
-				messageUUID := string(msg.Key)
-
-				ks.mu.RLock()
-				if responseChan, exists := ks.pendingRequests[messageUUID]; exists {
-					select {
-					case responseChan <- msg.Value:
-						log.Printf("UUID: %s", messageUUID)
-					default:
-						log.Printf("Канал заблокирован для UUID: %s", messageUUID)
-					}
-				} else {
-					log.Printf("Не найден ожидающий запрос для UUID: %s", messageUUID)
-				}
-				ks.mu.RUnlock()
-
-			case err := <-partitionConsumer.Errors():
-				log.Printf("Ошибка консьюмера: %v", err)
-
-			case <-ctx.Done():
-				log.Println("Остановка консьюмера ответов")
-				return
-			}
-		}
+		_, _, err := ks.admin.DescribeCluster()
+		done <- err
 	}()
 
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ConsumerHealth reports whether the reply consumer holds a group session.
+func (ks *KafkaService) ConsumerHealth(context.Context) error {
+	if !ks.consuming.Load() {
+		return errors.New("reply consumer has no active session")
+	}
 	return nil
 }
 
@@ -149,8 +235,14 @@ func (ks *KafkaService) Close() error {
 	if err := ks.producer.Close(); err != nil {
 		log.Printf("Ошибка закрытия продюсера: %v", err)
 	}
-	if err := ks.consumer.Close(); err != nil {
+	if err := ks.group.Close(); err != nil {
 		log.Printf("Ошибка закрытия консьюмера: %v", err)
 	}
+	if err := ks.admin.DeleteTopic(ks.replyTopic); err != nil {
+		log.Printf("Ошибка удаления топика ответов: %v", err)
+	}
+	if err := ks.admin.Close(); err != nil {
+		log.Printf("Ошибка закрытия cluster admin: %v", err)
+	}
 	return nil
 }
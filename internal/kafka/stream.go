@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	FramePartial = "partial"
+	FrameFinal   = "final"
+	FrameError   = "error"
+
+	streamBuffer = 256
+)
+
+// ErrStreamOverflow ends a stream whose reader fell behind by more than
+// streamBuffer chunks, so the answer would have a gap.
+var ErrStreamOverflow = errors.New("response stream overflowed")
+
+type ResponseChunk struct {
+	Frame   string
+	Payload []byte
+}
+
+// Done reports whether no more chunks will follow for the request.
+func (c ResponseChunk) Done() bool {
+	return c.Frame != FramePartial
+}
+
+// Stream is the ChatStream of the transports built on streamRegistry.
+type Stream struct {
+	streams  *streamRegistry
+	uuid     string
+	chunks   chan ResponseChunk
+	overflow chan struct{}
+	once     sync.Once
+	closed   sync.Once
+}
+
+// streamRegistry routes reply chunks to the open streams. Transports embed it
+// and call deliver for every reply they receive.
+type streamRegistry struct {
+	pending map[string]*Stream
+	mu      sync.RWMutex
+}
+
+func newStreamRegistry() streamRegistry {
+	return streamRegistry{pending: make(map[string]*Stream)}
+}
+
+func (r *streamRegistry) OpenStream(uuid string) ChatStream {
+	stream := &Stream{
+		streams:  r,
+		uuid:     uuid,
+		chunks:   make(chan ResponseChunk, streamBuffer),
+		overflow: make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.pending[uuid] = stream
+	r.mu.Unlock()
+
+	return stream
+}
+
+func (r *streamRegistry) deliver(uuid string, chunk ResponseChunk) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stream, exists := r.pending[uuid]
+	if !exists {
+		log.Printf("Не найден ожидающий запрос для UUID: %s", uuid)
+		return
+	}
+
+	select {
+	case <-stream.overflow:
+		return
+	default:
+	}
+
+	select {
+	case stream.chunks <- chunk:
+	default:
+		log.Printf("Буфер ответа переполнен, поток прерван для UUID: %s", uuid)
+		stream.once.Do(func() { close(stream.overflow) })
+	}
+}
+
+// Next waits for the next chunk. The timeout is applied between chunks, so a
+// long answer keeps the stream alive as long as the chat service makes progress.
+func (s *Stream) Next(ctx context.Context, timeout time.Duration) (ResponseChunk, error) {
+	select {
+	case <-s.overflow:
+		return ResponseChunk{}, ErrStreamOverflow
+	default:
+	}
+
+	select {
+	case chunk := <-s.chunks:
+		return chunk, nil
+	case <-s.overflow:
+		return ResponseChunk{}, ErrStreamOverflow
+	case <-ctx.Done():
+		return ResponseChunk{}, ctx.Err()
+	case <-time.After(timeout):
+		return ResponseChunk{}, fmt.Errorf("ttl for UUID: %s", s.uuid)
+	}
+}
+
+// Close unregisters the stream. It is safe to call more than once.
+func (s *Stream) Close() {
+	s.closed.Do(func() {
+		s.streams.mu.Lock()
+		delete(s.streams.pending, s.uuid)
+		s.streams.mu.Unlock()
+		close(s.chunks)
+	})
+}
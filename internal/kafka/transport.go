@@ -0,0 +1,30 @@
+package kafka
+
+import (
+	"context"
+	"time"
+)
+
+// ChatTransport carries chat requests to the chat service and streams its
+// replies back. KafkaService is the production implementation;
+// MemoryTransport runs the chat flow in-process.
+type ChatTransport interface {
+	Start(ctx context.Context) error
+	OpenStream(uuid string) ChatStream
+	SendMessage(uuid string, requestMsg RequestMessage, timeout time.Duration) error
+	Close() error
+}
+
+// ChatStream receives the reply chunks for one request. It must be opened
+// before the request is sent so that early chunks are not lost.
+type ChatStream interface {
+	// Next waits for the next chunk, at most timeout after the previous one.
+	Next(ctx context.Context, timeout time.Duration) (ResponseChunk, error)
+	Close()
+}
+
+var (
+	_ ChatTransport = (*KafkaService)(nil)
+	_ ChatTransport = (*MemoryTransport)(nil)
+	_ ChatStream    = (*Stream)(nil)
+)
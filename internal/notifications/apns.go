@@ -0,0 +1,148 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	apnsProductionHost = "https://api.push.apple.com"
+	apnsSandboxHost    = "https://api.sandbox.push.apple.com"
+	apnsTokenLifetime  = 50 * time.Minute
+)
+
+// APNsProvider delivers notifications to iOS devices using token-based
+// (.p8 key) authentication against the APNs HTTP/2 API.
+type APNsProvider struct {
+	key    *ecdsa.PrivateKey
+	keyID  string
+	teamID string
+	topic  string
+	host   string
+	client *http.Client
+
+	mu       sync.Mutex
+	bearer   string
+	issuedAt time.Time
+}
+
+func NewAPNsProvider(keyFile, keyID, teamID, topic string, production bool) (*APNsProvider, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read apns key: %w", err)
+	}
+
+	key, err := jwt.ParseECPrivateKeyFromPEM(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apns key: %w", err)
+	}
+
+	host := apnsSandboxHost
+	if production {
+		host = apnsProductionHost
+	}
+
+	return &APNsProvider{
+		key:    key,
+		keyID:  keyID,
+		teamID: teamID,
+		topic:  topic,
+		host:   host,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *APNsProvider) Send(ctx context.Context, token string, msg Message) error {
+	bearer, err := p.token()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": msg.Title,
+				"body":  msg.Body,
+			},
+			"sound": "default",
+		},
+	}
+	for k, v := range msg.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.host+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", p.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send apns message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&apnsErr)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		apnsErr.Reason == "BadDeviceToken",
+		apnsErr.Reason == "Unregistered":
+		return fmt.Errorf("apns rejected token: %s: %w", apnsErr.Reason, ErrInvalidToken)
+	default:
+		return fmt.Errorf("apns returned %d: %s", resp.StatusCode, apnsErr.Reason)
+	}
+}
+
+// token returns the provider JWT. Apple rejects tokens older than an hour and
+// throttles ones refreshed too often, so it is reused for most of that window.
+func (p *APNsProvider) token() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bearer != "" && time.Since(p.issuedAt) < apnsTokenLifetime {
+		return p.bearer, nil
+	}
+
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": p.teamID,
+		"iat": now.Unix(),
+	})
+	t.Header["kid"] = p.keyID
+
+	bearer, err := t.SignedString(p.key)
+	if err != nil {
+		return "", err
+	}
+
+	p.bearer = bearer
+	p.issuedAt = now
+
+	return p.bearer, nil
+}
@@ -0,0 +1,77 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+)
+
+// Consumer reads notification events from Kafka as part of a consumer group,
+// so each event is dispatched by exactly one gateway replica.
+type Consumer struct {
+	group      sarama.ConsumerGroup
+	topic      string
+	dispatcher *Dispatcher
+}
+
+func NewConsumer(brokers []string, groupID, topic string, dispatcher *Dispatcher) (*Consumer, error) {
+	cfg := sarama.NewConfig()
+	cfg.Consumer.Return.Errors = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+
+	group, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed create notifications consumer group: %v", err)
+	}
+
+	return &Consumer{
+		group:      group,
+		topic:      topic,
+		dispatcher: dispatcher,
+	}, nil
+}
+
+func (c *Consumer) Start(ctx context.Context) {
+	go func() {
+		for err := range c.group.Errors() {
+			log.Warn().Err(err).Msg("Notifications consumer error")
+		}
+	}()
+
+	go utils.RunConsumerGroup(ctx, c.group, []string{c.topic}, c, "notifications")
+}
+
+func (c *Consumer) Close() error {
+	return c.group.Close()
+}
+
+func (c *Consumer) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (c *Consumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			var event Event
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				log.Warn().Err(err).Msg("Skipping malformed notification event")
+			} else if err := c.dispatcher.Dispatch(session.Context(), event); err != nil {
+				log.Error().Err(err).Str("type", event.Type).Msg("Failed to dispatch notification event")
+			}
+
+			session.MarkMessage(msg, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
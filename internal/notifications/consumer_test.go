@@ -0,0 +1,133 @@
+package notifications
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+	"github.com/IBM/sarama"
+)
+
+func TestConsumerConsumeClaim(t *testing.T) {
+	devices := map[string][]storage.DeviceToken{
+		"user-1": {
+			{UserID: "user-1", Token: "ios-token", Platform: storage.PlatformIOS},
+			{UserID: "user-1", Token: "android-token", Platform: storage.PlatformAndroid},
+			{UserID: "user-1", Token: "legacy-token", Platform: storage.PlatformUnknown},
+		},
+		"user-2": {
+			{UserID: "user-2", Token: "stale-token", Platform: storage.PlatformAndroid},
+			{UserID: "user-2", Token: "web-token", Platform: storage.PlatformWeb},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		messages   []string
+		wantSent   []string
+		wantPruned []string
+		wantTitle  string
+	}{
+		{
+			name:      "delivers to every device with a provider",
+			messages:  []string{`{"type":"ticket.purchased","user_id":"user-1"}`},
+			wantSent:  []string{"ios-token", "android-token"},
+			wantTitle: "Билет оформлен",
+		},
+		{
+			name:      "keeps the producer's title",
+			messages:  []string{`{"type":"ticket.purchased","user_id":"user-1","title":"Custom"}`},
+			wantSent:  []string{"ios-token", "android-token"},
+			wantTitle: "Custom",
+		},
+		{
+			name:       "prunes tokens the provider rejects",
+			messages:   []string{`{"type":"donation.received","user_id":"user-2"}`},
+			wantSent:   []string{"web-token"},
+			wantPruned: []string{"stale-token"},
+			wantTitle:  "Спасибо за пожертвование",
+		},
+		{
+			name:     "skips malformed events and events without a user",
+			messages: []string{`{not json`, `{"type":"ticket.purchased"}`},
+		},
+		{
+			name:     "user without devices",
+			messages: []string{`{"type":"vote.closing_soon","user_id":"user-3"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := NewStubProvider("stale-token")
+			dispatcher := NewDispatcher(map[string]Provider{
+				storage.PlatformIOS:     stub,
+				storage.PlatformAndroid: stub,
+				storage.PlatformWeb:     stub,
+			})
+			dispatcher.listTokens = func(userID string) ([]storage.DeviceToken, error) {
+				return devices[userID], nil
+			}
+			var pruned []string
+			dispatcher.deleteTokens = func(tokens ...string) error {
+				pruned = append(pruned, tokens...)
+				return nil
+			}
+
+			claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(tt.messages))}
+			for i, value := range tt.messages {
+				claim.messages <- &sarama.ConsumerMessage{Offset: int64(i), Value: []byte(value)}
+			}
+			close(claim.messages)
+
+			session := &fakeSession{ctx: context.Background()}
+			consumer := &Consumer{dispatcher: dispatcher}
+			if err := consumer.ConsumeClaim(session, claim); err != nil {
+				t.Fatalf("ConsumeClaim() error = %v", err)
+			}
+
+			if session.marked != len(tt.messages) {
+				t.Errorf("marked %d messages, want %d", session.marked, len(tt.messages))
+			}
+
+			var sent []string
+			for _, msg := range stub.Sent() {
+				sent = append(sent, msg.Token)
+				if msg.Message.Title != tt.wantTitle {
+					t.Errorf("title = %q, want %q", msg.Message.Title, tt.wantTitle)
+				}
+			}
+			if !reflect.DeepEqual(sent, tt.wantSent) {
+				t.Errorf("sent to %v, want %v", sent, tt.wantSent)
+			}
+			if !reflect.DeepEqual(pruned, tt.wantPruned) {
+				t.Errorf("pruned %v, want %v", pruned, tt.wantPruned)
+			}
+		})
+	}
+}
+
+type fakeSession struct {
+	ctx    context.Context
+	marked int
+}
+
+func (s *fakeSession) Claims() map[string][]int32                  { return nil }
+func (s *fakeSession) MemberID() string                            { return "" }
+func (s *fakeSession) GenerationID() int32                         { return 0 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)     {}
+func (s *fakeSession) Commit()                                     {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string)    {}
+func (s *fakeSession) MarkMessage(*sarama.ConsumerMessage, string) { s.marked++ }
+func (s *fakeSession) Context() context.Context                    { return s.ctx }
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "notifications" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return int64(len(c.messages)) }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
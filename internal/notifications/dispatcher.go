@@ -0,0 +1,66 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+type Dispatcher struct {
+	providers map[string]Provider
+
+	// listTokens and deleteTokens default to the storage package and are
+	// replaced in tests.
+	listTokens   func(userID string) ([]storage.DeviceToken, error)
+	deleteTokens func(tokens ...string) error
+}
+
+// NewDispatcher routes deliveries by device platform (see storage.Platform*).
+// Devices whose platform has no provider are skipped.
+func NewDispatcher(providers map[string]Provider) *Dispatcher {
+	return &Dispatcher{
+		providers:    providers,
+		listTokens:   storage.ListUserTokens,
+		deleteTokens: storage.DeleteTokens,
+	}
+}
+
+func (d *Dispatcher) Dispatch(ctx context.Context, event Event) error {
+	if event.UserID == "" {
+		return fmt.Errorf("event %q has no user_id", event.Type)
+	}
+
+	devices, err := d.listTokens(event.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load device tokens: %w", err)
+	}
+
+	msg := event.message()
+	invalid := make([]string, 0)
+	for _, device := range devices {
+		provider, ok := d.providers[device.Platform]
+		if !ok {
+			continue
+		}
+
+		err := provider.Send(ctx, device.Token, msg)
+		switch {
+		case errors.Is(err, ErrInvalidToken):
+			invalid = append(invalid, device.Token)
+		case err != nil:
+			log.Warn().Err(err).Str("user_id", event.UserID).Str("platform", device.Platform).Msg("Failed to deliver push notification")
+		}
+	}
+
+	if len(invalid) > 0 {
+		if err := d.deleteTokens(invalid...); err != nil {
+			return fmt.Errorf("failed to prune invalid device tokens: %w", err)
+		}
+		log.Info().Str("user_id", event.UserID).Int("tokens", len(invalid)).Msg("Pruned invalid device tokens")
+	}
+
+	return nil
+}
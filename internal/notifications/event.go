@@ -0,0 +1,67 @@
+package notifications
+
+const (
+	EventTicketPurchased   = "ticket.purchased"
+	EventDonationReceived  = "donation.received"
+	EventVoteClosingSoon   = "vote.closing_soon"
+	defaultNotificationKey = ""
+)
+
+type Event struct {
+	Type   string            `json:"type"`
+	UserID string            `json:"user_id"`
+	Title  string            `json:"title,omitempty"`
+	Body   string            `json:"body,omitempty"`
+	Data   map[string]string `json:"data,omitempty"`
+}
+
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+var templates = map[string]Message{
+	EventTicketPurchased: {
+		Title: "Билет оформлен",
+		Body:  "Ваш билет успешно куплен. Он доступен в разделе «Мои билеты».",
+	},
+	EventDonationReceived: {
+		Title: "Спасибо за пожертвование",
+		Body:  "Ваше пожертвование получено.",
+	},
+	EventVoteClosingSoon: {
+		Title: "Голосование скоро завершится",
+		Body:  "Успейте отдать свой голос.",
+	},
+	defaultNotificationKey: {
+		Title: "Карта жителя",
+	},
+}
+
+// message builds the push payload, falling back to the built-in template for
+// the event type when the producer did not supply its own text.
+func (e Event) message() Message {
+	tmpl, ok := templates[e.Type]
+	if !ok {
+		tmpl = templates[defaultNotificationKey]
+	}
+
+	msg := Message{
+		Title: e.Title,
+		Body:  e.Body,
+		Data:  make(map[string]string, len(e.Data)+1),
+	}
+	if msg.Title == "" {
+		msg.Title = tmpl.Title
+	}
+	if msg.Body == "" {
+		msg.Body = tmpl.Body
+	}
+	for k, v := range e.Data {
+		msg.Data[k] = v
+	}
+	msg.Data["type"] = e.Type
+
+	return msg
+}
@@ -0,0 +1,58 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidToken is returned by providers when the device token is
+// permanently rejected and should be removed from storage.
+var ErrInvalidToken = errors.New("device token is no longer valid")
+
+type Provider interface {
+	Send(ctx context.Context, token string, msg Message) error
+}
+
+type SentMessage struct {
+	Token   string
+	Message Message
+}
+
+// StubProvider records messages instead of delivering them. Tokens listed in
+// Invalid are reported back as ErrInvalidToken.
+type StubProvider struct {
+	Invalid map[string]bool
+
+	mu   sync.Mutex
+	sent []SentMessage
+}
+
+func NewStubProvider(invalid ...string) *StubProvider {
+	p := &StubProvider{Invalid: make(map[string]bool, len(invalid))}
+	for _, token := range invalid {
+		p.Invalid[token] = true
+	}
+	return p
+}
+
+func (p *StubProvider) Send(_ context.Context, token string, msg Message) error {
+	if p.Invalid[token] {
+		return ErrInvalidToken
+	}
+
+	p.mu.Lock()
+	p.sent = append(p.sent, SentMessage{Token: token, Message: msg})
+	p.mu.Unlock()
+
+	log.Debug().Str("title", msg.Title).Msg("Stub push notification sent")
+	return nil
+}
+
+func (p *StubProvider) Sent() []SentMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]SentMessage(nil), p.sent...)
+}
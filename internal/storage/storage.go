@@ -2,15 +2,52 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWeb     = "web"
+	// PlatformUnknown is recorded for clients that register a token without
+	// naming their platform. Such tokens predate the platform field and are
+	// FCM registrations.
+	PlatformUnknown = "unknown"
+)
+
+const (
+	ttlIndexName          = "last_seen_at_ttl"
+	indexOptionsConflict  = 85
+	indexKeySpecsConflict = 86
+	operationTimeout      = 5 * time.Second
+)
+
 var client *mongo.Client
 var collection *mongo.Collection
 
-func Connect(uri, dbName, collectionName string) error {
+type DeviceToken struct {
+	UserID     string    `bson:"user_id" json:"-"`
+	Token      string    `bson:"token" json:"token"`
+	Platform   string    `bson:"platform" json:"platform"`
+	AppVersion string    `bson:"app_version,omitempty" json:"app_version,omitempty"`
+	Locale     string    `bson:"locale,omitempty" json:"locale,omitempty"`
+	LastSeenAt time.Time `bson:"last_seen_at" json:"last_seen_at"`
+}
+
+func IsValidPlatform(platform string) bool {
+	switch platform {
+	case PlatformIOS, PlatformAndroid, PlatformWeb:
+		return true
+	}
+	return false
+}
+
+func Connect(uri, dbName, collectionName string, tokenTTL time.Duration) error {
 	clientOptions := options.Client().ApplyURI(uri)
 	var err error
 	client, err = mongo.Connect(context.Background(), clientOptions)
@@ -22,15 +59,152 @@ func Connect(uri, dbName, collectionName string) error {
 		return err
 	}
 	collection = client.Database(dbName).Collection(collectionName)
-	return nil
+	return ensureIndexes(dbName, collectionName, tokenTTL)
+}
+
+func ensureIndexes(dbName, collectionName string, tokenTTL time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"token": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if tokenTTL <= 0 {
+		return nil
+	}
+
+	ttlSeconds := int32(tokenTTL / time.Second)
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "last_seen_at", Value: 1}},
+		Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(ttlSeconds),
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == indexOptionsConflict || cmdErr.Code == indexKeySpecsConflict) {
+		return client.Database(dbName).RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collectionName},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: ttlIndexName},
+				{Key: "expireAfterSeconds", Value: ttlSeconds},
+			}},
+		}).Err()
+	}
+	return err
 }
 
-func AddUserToken(userID, token string) error {
+// AddUserToken registers the device token for the user or refreshes its
+// metadata and last-seen time if it is already known.
+func AddUserToken(device DeviceToken) error {
+	if device.LastSeenAt.IsZero() {
+		device.LastSeenAt = time.Now().UTC()
+	}
 	_, err := collection.UpdateOne(
 		context.Background(),
-		bson.M{"user_id": userID},
-		bson.M{"$addToSet": bson.M{"tokens": token}},
+		bson.M{"token": device.Token},
+		bson.M{"$set": device},
 		options.Update().SetUpsert(true),
 	)
 	return err
 }
+
+// ImportUserToken stores the device token only if it is not registered yet, so
+// fresher metadata written by the app is never overwritten.
+func ImportUserToken(device DeviceToken) error {
+	_, err := collection.UpdateOne(
+		context.Background(),
+		bson.M{"token": device.Token},
+		bson.M{"$setOnInsert": device},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func ListUserTokens(userID string) ([]DeviceToken, error) {
+	ctx := context.Background()
+	cursor, err := collection.Find(
+		ctx,
+		bson.M{"user_id": userID, "token": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := make([]DeviceToken, 0)
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func DeleteUserToken(userID, token string) (bool, error) {
+	res, err := collection.DeleteOne(context.Background(), bson.M{"user_id": userID, "token": token})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func DeleteTokens(tokens ...string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	_, err := collection.DeleteMany(context.Background(), bson.M{"token": bson.M{"$in": tokens}})
+	return err
+}
+
+// ForEachLegacyDocument walks documents in the old one-document-per-user
+// layout where tokens were kept as a bare string array.
+func ForEachLegacyDocument(fn func(owner string, tokens []string) error) error {
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, bson.M{"tokens": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			UserID string   `bson:"user_id"`
+			Tokens []string `bson:"tokens"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc.UserID, doc.Tokens); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func DeleteLegacyDocument(owner string) error {
+	_, err := collection.DeleteOne(context.Background(), bson.M{"user_id": owner, "tokens": bson.M{"$exists": true}})
+	return err
+}
+
+func Disconnect(ctx context.Context) error {
+	if client == nil {
+		return nil
+	}
+	return client.Disconnect(ctx)
+}
+
+func Ping(ctx context.Context) error {
+	if client == nil {
+		return errors.New("mongo client is not connected")
+	}
+	return client.Ping(ctx, nil)
+}
@@ -0,0 +1,168 @@
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// checkInterval limits how often the files are stat'ed, since handshakes can
+// be frequent on a busy listener.
+const checkInterval = 5 * time.Second
+
+// KeyPair serves a certificate and key from disk and picks up new versions of
+// the files on the next handshake after they change. If a changed pair fails
+// to load, the previous one keeps being served.
+type KeyPair struct {
+	certFile  string
+	keyFile   string
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+	mu        sync.Mutex
+}
+
+func NewKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both certificate and key files are required")
+	}
+
+	kp := &KeyPair{certFile: certFile, keyFile: keyFile}
+	modTime, err := latestModTime(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := kp.load(modTime); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+func (kp *KeyPair) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair %s: %w", kp.certFile, err)
+	}
+	kp.cert = &cert
+	kp.modTime = modTime
+	return nil
+}
+
+// Certificate returns the current certificate, reloading it if the files
+// changed since the last check.
+func (kp *KeyPair) Certificate() *tls.Certificate {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	if time.Since(kp.checkedAt) < checkInterval {
+		return kp.cert
+	}
+	kp.checkedAt = time.Now()
+
+	modTime, err := latestModTime(kp.certFile, kp.keyFile)
+	if err != nil {
+		log.Warn().Err(err).Str("file", kp.certFile).Msg("Failed to check certificate files")
+		return kp.cert
+	}
+	if !modTime.After(kp.modTime) {
+		return kp.cert
+	}
+
+	if err := kp.load(modTime); err != nil {
+		log.Warn().Err(err).Msg("Failed to reload certificate, keeping the previous one")
+		return kp.cert
+	}
+	log.Info().Str("file", kp.certFile).Msg("Certificate reloaded")
+	return kp.cert
+}
+
+func (kp *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return kp.Certificate(), nil
+}
+
+func (kp *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return kp.Certificate(), nil
+}
+
+// CertPool serves a CA bundle from disk and reloads it when the file changes.
+type CertPool struct {
+	file      string
+	pool      *x509.CertPool
+	modTime   time.Time
+	checkedAt time.Time
+	mu        sync.Mutex
+}
+
+func NewCertPool(file string) (*CertPool, error) {
+	cp := &CertPool{file: file}
+	modTime, err := latestModTime(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := cp.load(modTime); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (cp *CertPool) load(modTime time.Time) error {
+	raw, err := os.ReadFile(cp.file)
+	if err != nil {
+		return fmt.Errorf("failed to read CA bundle %s: %w", cp.file, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return fmt.Errorf("no certificates found in CA bundle %s", cp.file)
+	}
+	cp.pool = pool
+	cp.modTime = modTime
+	return nil
+}
+
+// Pool returns the current CA pool, reloading it if the file changed since
+// the last check.
+func (cp *CertPool) Pool() *x509.CertPool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if time.Since(cp.checkedAt) < checkInterval {
+		return cp.pool
+	}
+	cp.checkedAt = time.Now()
+
+	modTime, err := latestModTime(cp.file)
+	if err != nil {
+		log.Warn().Err(err).Str("file", cp.file).Msg("Failed to check CA bundle")
+		return cp.pool
+	}
+	if !modTime.After(cp.modTime) {
+		return cp.pool
+	}
+
+	if err := cp.load(modTime); err != nil {
+		log.Warn().Err(err).Msg("Failed to reload CA bundle, keeping the previous one")
+		return cp.pool
+	}
+	log.Info().Str("file", cp.file).Msg("CA bundle reloaded")
+	return cp.pool
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Backoff produces exponentially growing delays between retries of a failing
+// operation, such as a Kafka consumer group that cannot reach the brokers.
+// The zero value starts at 100ms and caps at 30s.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	next time.Duration
+}
+
+// Wait sleeps for the current delay and doubles it for the next call. It
+// returns false without waiting out the delay once ctx is done.
+func (b *Backoff) Wait(ctx context.Context) bool {
+	if b.next == 0 {
+		b.next = b.Initial
+		if b.next <= 0 {
+			b.next = 100 * time.Millisecond
+		}
+	}
+	maxDelay := b.Max
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	timer := time.NewTimer(b.next)
+	defer timer.Stop()
+
+	b.next = min(b.next*2, maxDelay)
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Reset starts the next Wait from the initial delay again.
+func (b *Backoff) Reset() {
+	b.next = 0
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog/log"
+)
+
+// RunConsumerGroup consumes topics until ctx is done or the group is closed.
+// Consume returns on every rebalance, so it is called in a loop; failed runs
+// are retried with a Backoff. The name only labels the log entries.
+func RunConsumerGroup(ctx context.Context, group sarama.ConsumerGroup, topics []string, handler sarama.ConsumerGroupHandler, name string) {
+	var backoff Backoff
+	for {
+		if err := group.Consume(ctx, topics, handler); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			log.Error().Err(err).Str("consumer", name).Msg("Kafka consumer stopped")
+			if !backoff.Wait(ctx) {
+				return
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		backoff.Reset()
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the client address without the port. Behind the realip
+// middleware RemoteAddr may hold a bare address, otherwise it is host:port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,26 +1,29 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
-	"net/http"
-	"sync"
 	"time"
 
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
 	"github.com/GP-Hacks/kdt2024-gateway/internal/kafka"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 type Client struct {
-	conn       *websocket.Conn
-	send       chan []byte
-	processing bool
-	mu         sync.Mutex
+	conn     *websocket.Conn
+	identity *jwtauth.Identity
+	session  *Session
+	send     chan []byte
 }
 
-func (c *Client) readPump(hub *Hub, kafkaService *kafka.KafkaService, timeout time.Duration) {
+func (c *Client) readPump(hub *Hub) {
 	defer func() {
+		// Сессия отвязывается до unregister, иначе она может писать в закрытый канал send.
+		c.session.detach(c)
 		hub.unregister <- c
 		c.conn.Close()
 	}()
@@ -32,79 +35,99 @@ func (c *Client) readPump(hub *Hub, kafkaService *kafka.KafkaService, timeout ti
 			break
 		}
 
-		c.mu.Lock()
-		if c.processing {
-			c.mu.Unlock()
-			log.Println("Клиент уже обрабатывает сообщение, игнорируем новое")
+		var env Envelope
+		if err := json.Unmarshal(message, &env); err != nil {
+			log.Printf("Ошибка парсинга сообщения от клиента: %v", err)
+			c.session.deliverError("", ErrCodeInvalidMessage, "invalid message format")
 			continue
 		}
-		c.processing = true
-		c.mu.Unlock()
-
-		go func(msg []byte) {
-			defer func() {
-				c.mu.Lock()
-				c.processing = false
-				c.mu.Unlock()
-			}()
-
-			var requestMsg kafka.RequestMessage
-			if err := json.Unmarshal(msg, &requestMsg); err != nil {
-				log.Printf("Ошибка парсинга сообщения от клиента: %v", err)
-				errorResponse := kafka.ErrorResponse{
-					Status:    "error",
-					Error:     "invalid message format",
-					CreatedAt: time.Now().Format(time.RFC3339Nano),
-				}
-				errorBytes, _ := json.Marshal(errorResponse)
-				select {
-				case c.send <- errorBytes:
-				default:
-					log.Println("Канал отправки заблокирован")
-				}
-				return
-			}
 
-			messageUUID := uuid.New().String()
-			if err := kafkaService.SendMessage(messageUUID, requestMsg); err != nil {
-				log.Printf("Ошибка отправки в Kafka: %v", err)
-				errorResponse := kafka.ErrorResponse{
-					Status:    "error",
-					Error:     "failed to process message",
-					CreatedAt: time.Now().Format(time.RFC3339Nano),
-				}
-				errorBytes, _ := json.Marshal(errorResponse)
-				select {
-				case c.send <- errorBytes:
-				default:
-					log.Println("Канал отправки заблокирован")
-				}
+		switch env.Type {
+		case TypePing:
+			c.reply(Envelope{Type: TypePong, ID: env.ID})
+		case TypeChatSend:
+			c.session.enqueue(env)
+		case TypeChatCancel:
+			c.session.cancel(env.ID)
+		default:
+			c.session.deliverError(env.ID, ErrCodeUnknownType, "unknown message type")
+		}
+	}
+}
+
+// runChat sends one chat request to Kafka and passes every reply frame to
+// reply. It is shared by the WebSocket and SSE transports.
+func runChat(ctx context.Context, id string, requestMsg kafka.RequestMessage, transport kafka.ChatTransport, timeout time.Duration, reply func(Envelope)) {
+	replyError := func(code, message string) {
+		reply(Envelope{Type: TypeError, ID: id, Error: &EnvelopeError{Code: code, Message: message}})
+	}
+
+	messageUUID := uuid.New().String()
+	stream := transport.OpenStream(messageUUID)
+	defer stream.Close()
+
+	if err := transport.SendMessage(messageUUID, requestMsg, timeout); err != nil {
+		log.Printf("Ошибка отправки в Kafka: %v", err)
+		replyError(ErrCodeUpstream, "failed to process message")
+		return
+	}
+
+	for {
+		chunk, err := stream.Next(ctx, timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				replyError(ErrCodeCancelled, "request cancelled")
 				return
 			}
-
-			response, err := kafkaService.WaitForResponse(messageUUID, timeout)
-			if err != nil {
-				log.Printf("Ошибка ожидания ответа: %v", err)
-				errorResponse := kafka.ErrorResponse{
-					Status:    "error",
-					Error:     "request timeout",
-					CreatedAt: time.Now().Format(time.RFC3339Nano),
-				}
-				errorBytes, _ := json.Marshal(errorResponse)
-				select {
-				case c.send <- errorBytes:
-				default:
-					log.Println("Канал отправки заблокирован")
-				}
+			if errors.Is(err, kafka.ErrStreamOverflow) {
+				replyError(ErrCodeUpstream, "response stream overflowed")
 				return
 			}
+			log.Printf("Ошибка ожидания ответа: %v", err)
+			replyError(ErrCodeTimeout, "request timeout")
+			return
+		}
 
-			select {
-			case c.send <- response:
-			default:
-				log.Println("Канал отправки заблокирован")
+		switch chunk.Frame {
+		case kafka.FramePartial:
+			reply(Envelope{Type: TypeChatChunk, ID: id, Payload: rawPayload(chunk.Payload)})
+		case kafka.FrameError:
+			var errorResponse kafka.ErrorResponse
+			_ = json.Unmarshal(chunk.Payload, &errorResponse)
+			if errorResponse.Error == "" {
+				errorResponse.Error = "chat service error"
 			}
-		}(message)
+			replyError(ErrCodeUpstream, errorResponse.Error)
+		default:
+			reply(Envelope{Type: TypeChatDone, ID: id, Payload: rawPayload(chunk.Payload)})
+		}
+
+		if chunk.Done() {
+			return
+		}
+	}
+}
+
+func (c *Client) reply(env Envelope) {
+	env.Version = ProtocolVersion
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Ошибка сериализации ответа: %v", err)
+		return
+	}
+
+	c.push(data)
+}
+
+// push queues data for writePump. A client that does not keep up is
+// disconnected rather than silently missing frames: on reconnect it resumes
+// its session and gets them replayed.
+func (c *Client) push(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		log.Println("Канал отправки заблокирован, соединение закрыто")
+		c.conn.Close()
 	}
 }
 
@@ -115,6 +138,13 @@ func (c *Client) writePump() {
 		c.conn.Close()
 	}()
 
+	var expired <-chan time.Time
+	if !c.identity.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(c.identity.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
 	for {
 		select {
 		case message, ok := <-c.send:
@@ -134,24 +164,11 @@ func (c *Client) writePump() {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
-		}
-	}
-}
-
-func ServeWS(hub *Hub, kafkaService *kafka.KafkaService, timeout time.Duration, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("Ошибка upgrade WebSocket: %v", err)
-		return
-	}
 
-	client := &Client{
-		conn: conn,
-		send: make(chan []byte, 256),
+		case <-expired:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired"))
+			return
+		}
 	}
-
-	hub.register <- client
-
-	go client.writePump()
-	go client.readPump(hub, kafkaService, timeout)
 }
@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/kafka"
+)
+
+func TestRunChat(t *testing.T) {
+	reply := func(frames ...kafka.ResponseChunk) kafka.ChatHandler {
+		return func(_ context.Context, _ kafka.RequestMessage, reply func(kafka.ResponseChunk)) {
+			for _, frame := range frames {
+				reply(frame)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		handler kafka.ChatHandler
+		cancel  bool
+		want    []string
+	}{
+		{
+			name:    "final answer",
+			handler: kafka.EchoHandler,
+			want:    []string{TypeChatDone},
+		},
+		{
+			name: "streamed answer",
+			handler: reply(
+				kafka.ResponseChunk{Frame: kafka.FramePartial, Payload: []byte(`"a"`)},
+				kafka.ResponseChunk{Frame: kafka.FramePartial, Payload: []byte(`"b"`)},
+				kafka.ResponseChunk{Frame: kafka.FrameFinal, Payload: []byte(`"c"`)},
+			),
+			want: []string{TypeChatChunk, TypeChatChunk, TypeChatDone},
+		},
+		{
+			name:    "chat service error",
+			handler: reply(kafka.ResponseChunk{Frame: kafka.FrameError, Payload: []byte(`{"error":"boom"}`)}),
+			want:    []string{TypeError + ":" + ErrCodeUpstream + ":boom"},
+		},
+		{
+			name:    "no answer",
+			handler: reply(),
+			want:    []string{TypeError + ":" + ErrCodeTimeout + ":request timeout"},
+		},
+		{
+			name:    "cancelled request",
+			handler: reply(),
+			cancel:  true,
+			want:    []string{TypeError + ":" + ErrCodeCancelled + ":request cancelled"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := kafka.NewMemoryTransport(tt.handler)
+			defer transport.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			var got []string
+			runChat(ctx, "req-1", kafka.RequestMessage{Content: "hello"}, transport, 50*time.Millisecond, func(env Envelope) {
+				if env.ID != "req-1" {
+					t.Errorf("reply ID = %q, want %q", env.ID, "req-1")
+				}
+				if env.Error != nil {
+					got = append(got, env.Type+":"+env.Error.Code+":"+env.Error.Message)
+					return
+				}
+				got = append(got, env.Type)
+			})
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
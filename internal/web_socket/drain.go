@@ -0,0 +1,46 @@
+package websocket
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// drainState lets chat requests that are already running finish on
+// shutdown, while new ones are refused.
+type drainState struct {
+	draining atomic.Bool
+	active   atomic.Int64
+}
+
+// begin registers a running request. It returns false once draining started.
+func (d *drainState) begin() bool {
+	if d.draining.Load() {
+		return false
+	}
+	d.active.Add(1)
+	if d.draining.Load() {
+		d.active.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (d *drainState) end() {
+	d.active.Add(-1)
+}
+
+// wait blocks until no request is running or ctx is done.
+func (d *drainState) wait(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for d.active.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import "encoding/json"
+
+const ProtocolVersion = 1
+
+const (
+	TypePing       = "ping"
+	TypePong       = "pong"
+	TypeChatSend   = "chat.send"
+	TypeChatCancel = "chat.cancel"
+	TypeChatChunk  = "chat.chunk"
+	TypeChatDone   = "chat.done"
+	TypeError      = "error"
+	TypeEvent      = "event"
+	TypeSession    = "session"
+)
+
+const (
+	ErrCodeInvalidMessage = "invalid_message"
+	ErrCodeUnknownType    = "unknown_type"
+	ErrCodeBusy           = "busy"
+	ErrCodeUpstream       = "upstream_error"
+	ErrCodeTimeout        = "timeout"
+	ErrCodeCancelled      = "cancelled"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeTokenExpired   = "token_expired"
+	ErrCodeShuttingDown   = "shutting_down"
+)
+
+// Envelope is the frame exchanged over the chat socket in both directions.
+// Replies always carry the ID of the client frame they answer and a session
+// sequence number used to resume after a reconnect.
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   *EnvelopeError  `json:"error,omitempty"`
+}
+
+// PushEvent is the payload of server-initiated "event" frames.
+type PushEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+type EnvelopeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// rawPayload passes JSON produced upstream through untouched and wraps
+// anything else as a JSON string.
+func rawPayload(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return b
+	}
+	quoted, _ := json.Marshal(string(b))
+	return quoted
+}
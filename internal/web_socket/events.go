@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/IBM/sarama"
+)
+
+// Event is published by backend services to the realtime events topic. An
+// event without user_id is delivered only when broadcast is set.
+type Event struct {
+	Type      string          `json:"type"`
+	UserID    string          `json:"user_id,omitempty"`
+	Broadcast bool            `json:"broadcast,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// EventSubscriber forwards realtime events from Kafka to the hub. Instances
+// share one consumer group; the hub fanout then reaches the user's sockets on
+// whichever instance they are connected to.
+type EventSubscriber struct {
+	group sarama.ConsumerGroup
+	topic string
+	hub   *Hub
+}
+
+func NewEventSubscriber(brokers []string, groupID, topic string, hub *Hub) (*EventSubscriber, error) {
+	cfg := sarama.NewConfig()
+	cfg.Consumer.Return.Errors = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+
+	group, err := sarama.NewConsumerGroup(brokers, groupID, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed create events consumer group: %v", err)
+	}
+
+	return &EventSubscriber{
+		group: group,
+		topic: topic,
+		hub:   hub,
+	}, nil
+}
+
+func (s *EventSubscriber) Start(ctx context.Context) {
+	go func() {
+		for err := range s.group.Errors() {
+			log.Printf("Ошибка консьюмера событий: %v", err)
+		}
+	}()
+
+	go utils.RunConsumerGroup(ctx, s.group, []string{s.topic}, s, "events")
+}
+
+func (s *EventSubscriber) Close() error {
+	return s.group.Close()
+}
+
+func (s *EventSubscriber) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (s *EventSubscriber) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (s *EventSubscriber) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			s.handle(msg.Value)
+			session.MarkMessage(msg, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s *EventSubscriber) handle(value []byte) {
+	var event Event
+	if err := json.Unmarshal(value, &event); err != nil || event.Type == "" {
+		log.Printf("Пропущено некорректное событие: %s", string(value))
+		return
+	}
+
+	payload, err := json.Marshal(PushEvent{Event: event.Type, Data: event.Data})
+	if err != nil {
+		log.Printf("Ошибка сериализации события: %v", err)
+		return
+	}
+	env := Envelope{Type: TypeEvent, Payload: payload}
+
+	switch {
+	case event.UserID != "":
+		s.hub.SendToUser(event.UserID, env)
+	case event.Broadcast:
+		s.hub.Broadcast(env)
+	default:
+		log.Printf("Событие %q без получателя пропущено", event.Type)
+	}
+}
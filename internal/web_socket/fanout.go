@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// FanoutMessage is a frame addressed to a user (or to everyone when UserID
+// is empty) that every gateway instance delivers to its own sockets.
+type FanoutMessage struct {
+	ID      string          `json:"id"`
+	UserID  string          `json:"user_id,omitempty"`
+	SSEOnly bool            `json:"sse_only,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Fanout spreads hub deliveries across gateway instances. Publish must reach
+// every subscribed instance, including the publishing one.
+type Fanout interface {
+	Publish(ctx context.Context, msg FanoutMessage) error
+	Subscribe(ctx context.Context, handler func(FanoutMessage)) error
+	Close() error
+}
+
+// MemoryFanout delivers within the current process only. It is meant for
+// tests and single-instance deployments.
+type MemoryFanout struct {
+	mu       sync.RWMutex
+	handlers []func(FanoutMessage)
+}
+
+func NewMemoryFanout() *MemoryFanout {
+	return &MemoryFanout{}
+}
+
+func (f *MemoryFanout) Publish(_ context.Context, msg FanoutMessage) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, handler := range f.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (f *MemoryFanout) Subscribe(_ context.Context, handler func(FanoutMessage)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.handlers = append(f.handlers, handler)
+	return nil
+}
+
+func (f *MemoryFanout) Close() error {
+	return nil
+}
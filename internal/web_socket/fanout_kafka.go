@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/IBM/sarama"
+)
+
+// KafkaFanout publishes to a broadcast topic that each instance consumes
+// with its own consumer group.
+type KafkaFanout struct {
+	producer sarama.SyncProducer
+	group    sarama.ConsumerGroup
+	topic    string
+}
+
+func NewKafkaFanout(brokers []string, topic, instanceID string) (*KafkaFanout, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	cfg.Consumer.Return.Errors = true
+	cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+
+	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed create fanout producer: %v", err)
+	}
+
+	group, err := sarama.NewConsumerGroup(brokers, "gateway-fanout-"+instanceID, cfg)
+	if err != nil {
+		producer.Close()
+		return nil, fmt.Errorf("failed create fanout consumer group: %v", err)
+	}
+
+	return &KafkaFanout{
+		producer: producer,
+		group:    group,
+		topic:    topic,
+	}, nil
+}
+
+func (f *KafkaFanout) Publish(_ context.Context, msg FanoutMessage) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = f.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: f.topic,
+		Key:   sarama.StringEncoder(msg.UserID),
+		Value: sarama.ByteEncoder(value),
+	})
+	return err
+}
+
+func (f *KafkaFanout) Subscribe(ctx context.Context, handler func(FanoutMessage)) error {
+	go func() {
+		for err := range f.group.Errors() {
+			log.Printf("Ошибка консьюмера fanout: %v", err)
+		}
+	}()
+
+	go utils.RunConsumerGroup(ctx, f.group, []string{f.topic}, &fanoutConsumer{handler: handler}, "fanout")
+
+	return nil
+}
+
+func (f *KafkaFanout) Close() error {
+	return errors.Join(f.group.Close(), f.producer.Close())
+}
+
+type fanoutConsumer struct {
+	handler func(FanoutMessage)
+}
+
+func (c *fanoutConsumer) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (c *fanoutConsumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (c *fanoutConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			var fm FanoutMessage
+			if err := json.Unmarshal(msg.Value, &fm); err != nil {
+				log.Printf("Пропущено некорректное fanout сообщение: %v", err)
+			} else {
+				c.handler(fm)
+			}
+			session.MarkMessage(msg, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
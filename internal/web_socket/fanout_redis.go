@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisFanout uses Redis pub/sub. Delivery is at-most-once: instances that
+// are disconnected from Redis miss messages published meanwhile.
+type RedisFanout struct {
+	client  *redis.Client
+	channel string
+	pubsub  *redis.PubSub
+}
+
+func NewRedisFanout(client *redis.Client, channel string) *RedisFanout {
+	return &RedisFanout{client: client, channel: channel}
+}
+
+func (f *RedisFanout) Publish(ctx context.Context, msg FanoutMessage) error {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return f.client.Publish(ctx, f.channel, value).Err()
+}
+
+func (f *RedisFanout) Subscribe(ctx context.Context, handler func(FanoutMessage)) error {
+	f.pubsub = f.client.Subscribe(ctx, f.channel)
+	if _, err := f.pubsub.Receive(ctx); err != nil {
+		f.pubsub.Close()
+		return err
+	}
+
+	go func() {
+		for msg := range f.pubsub.Channel() {
+			var fm FanoutMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &fm); err != nil {
+				log.Printf("Пропущено некорректное fanout сообщение: %v", err)
+				continue
+			}
+			handler(fm)
+		}
+	}()
+
+	return nil
+}
+
+func (f *RedisFanout) Close() error {
+	if f.pubsub == nil {
+		return nil
+	}
+	return f.pubsub.Close()
+}
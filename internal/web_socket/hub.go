@@ -1,29 +1,264 @@
 package websocket
 
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// recentDeliveries bounds the set of fanout message IDs remembered to drop
+// redelivered messages.
+const recentDeliveries = 1024
+
+// Hub keeps track of connected clients indexed by user ID. A user may have
+// several connections open at once, one per device and possibly on
+// different instances; deliveries go through the fanout so that every
+// instance reaches its own sockets.
 type Hub struct {
-	clients    map[*Client]bool
+	clients    map[string]map[*Client]bool
+	streams    map[string]map[*sseStream]bool
+	history    map[string]*replayLog
+	replaySize int
+	replayTTL  time.Duration
+	epoch      string
 	register   chan *Client
 	unregister chan *Client
+	attach     chan *sseStream
+	detach     chan *sseStream
+	deliveries chan FanoutMessage
+	closing    chan closeRequest
+	fanout     Fanout
+	seen       map[string]bool
+	seenOrder  []string
+}
+
+type closeRequest struct {
+	code int
+	text string
+	done chan struct{}
+}
+
+type sseStream struct {
+	userID      string
+	lastEventID string
+	events      chan streamEvent
+	// overflow is closed by the hub when events is full. The handler then
+	// ends the response and the client reconnects with Last-Event-ID.
+	overflow   chan struct{}
+	overflowed bool
 }
 
-func NewHub() *Hub {
+func NewHub(fanout Fanout, replaySize int, replayTTL time.Duration) *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
+		clients:    make(map[string]map[*Client]bool),
+		streams:    make(map[string]map[*sseStream]bool),
+		history:    make(map[string]*replayLog),
+		replaySize: replaySize,
+		replayTTL:  replayTTL,
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 36),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		attach:     make(chan *sseStream),
+		detach:     make(chan *sseStream),
+		deliveries: make(chan FanoutMessage, 256),
+		closing:    make(chan closeRequest),
+		fanout:     fanout,
+		seen:       make(map[string]bool, recentDeliveries),
+		seenOrder:  make([]string, 0, recentDeliveries),
 	}
 }
 
+// Listen subscribes the hub to deliveries published by any instance.
+func (h *Hub) Listen(ctx context.Context) error {
+	return h.fanout.Subscribe(ctx, func(msg FanoutMessage) {
+		h.deliveries <- msg
+	})
+}
+
 func (h *Hub) Run() {
+	cleanup := time.NewTicker(h.replayTTL / 2)
+	defer cleanup.Stop()
+
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
+			userID := client.identity.UserID
+			if h.clients[userID] == nil {
+				h.clients[userID] = make(map[*Client]bool)
+			}
+			h.clients[userID][client] = true
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
+			userID := client.identity.UserID
+			if _, ok := h.clients[userID][client]; ok {
+				delete(h.clients[userID], client)
+				if len(h.clients[userID]) == 0 {
+					delete(h.clients, userID)
+				}
 				close(client.send)
 			}
+		case stream := <-h.attach:
+			if h.streams[stream.userID] == nil {
+				h.streams[stream.userID] = make(map[*sseStream]bool)
+			}
+			h.streams[stream.userID][stream] = true
+			h.pushStreams(map[*sseStream]bool{stream: true}, h.history[stream.userID].since(h.epoch, stream.lastEventID)...)
+		case stream := <-h.detach:
+			if _, ok := h.streams[stream.userID][stream]; ok {
+				delete(h.streams[stream.userID], stream)
+				if len(h.streams[stream.userID]) == 0 {
+					delete(h.streams, stream.userID)
+				}
+				close(stream.events)
+			}
+		case msg := <-h.deliveries:
+			if h.duplicate(msg.ID) {
+				continue
+			}
+			if msg.UserID == "" {
+				if !msg.SSEOnly {
+					for _, conns := range h.clients {
+						h.push(conns, msg.Data)
+					}
+				}
+				for _, streams := range h.streams {
+					h.pushStreams(streams, streamEvent{Data: msg.Data})
+				}
+			} else {
+				if !msg.SSEOnly {
+					h.push(h.clients[msg.UserID], msg.Data)
+				}
+				// Only users streaming from this instance, now or recently,
+				// are worth keeping a replay log for.
+				if _, ok := h.history[msg.UserID]; ok || len(h.streams[msg.UserID]) > 0 {
+					h.pushStreams(h.streams[msg.UserID], h.record(msg.UserID, msg.Data))
+				}
+			}
+		case req := <-h.closing:
+			// A slow client can hold WriteControl up to its deadline, so the
+			// frames are written off the hub loop, all at once.
+			message := websocket.FormatCloseMessage(req.code, req.text)
+			var wg sync.WaitGroup
+			for _, conns := range h.clients {
+				for client := range conns {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+					}()
+				}
+			}
+			go func() {
+				wg.Wait()
+				close(req.done)
+			}()
+		case <-cleanup.C:
+			for userID, l := range h.history {
+				if time.Since(l.touched) > h.replayTTL {
+					delete(h.history, userID)
+				}
+			}
+		}
+	}
+}
+
+func (h *Hub) record(userID string, data []byte) streamEvent {
+	l, ok := h.history[userID]
+	if !ok {
+		l = &replayLog{}
+		h.history[userID] = l
+	}
+	return l.append(h.epoch, h.replaySize, data)
+}
+
+func (h *Hub) pushStreams(streams map[*sseStream]bool, events ...streamEvent) {
+	for stream := range streams {
+		for _, event := range events {
+			if stream.overflowed {
+				break
+			}
+			select {
+			case stream.events <- event:
+			default:
+				log.Println("Канал SSE заблокирован, поток закрыт")
+				stream.overflowed = true
+				close(stream.overflow)
+			}
 		}
 	}
 }
+
+func (h *Hub) duplicate(id string) bool {
+	if id == "" {
+		return false
+	}
+	if h.seen[id] {
+		return true
+	}
+
+	if len(h.seenOrder) == recentDeliveries {
+		delete(h.seen, h.seenOrder[0])
+		h.seenOrder = h.seenOrder[1:]
+	}
+	h.seen[id] = true
+	h.seenOrder = append(h.seenOrder, id)
+	return false
+}
+
+func (h *Hub) push(conns map[*Client]bool, data []byte) {
+	for client := range conns {
+		client.push(data)
+	}
+}
+
+// SendToUser pushes env to every connection of the user on all instances.
+func (h *Hub) SendToUser(userID string, env Envelope) {
+	if userID == "" {
+		return
+	}
+	h.publish(userID, false, env)
+}
+
+// Broadcast pushes env to every connection on all instances.
+func (h *Hub) Broadcast(env Envelope) {
+	h.publish("", false, env)
+}
+
+// sendToStreams pushes env to the user's SSE streams only. Chat replies to
+// POST /api/chat/send go this way, since WebSocket clients get their own.
+func (h *Hub) sendToStreams(userID string, env Envelope) {
+	h.publish(userID, true, env)
+}
+
+func (h *Hub) publish(userID string, sseOnly bool, env Envelope) {
+	env.Version = ProtocolVersion
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Ошибка сериализации события: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg := FanoutMessage{ID: uuid.New().String(), UserID: userID, SSEOnly: sseOnly, Data: data}
+	if err := h.fanout.Publish(ctx, msg); err != nil {
+		log.Printf("Ошибка публикации события: %v", err)
+	}
+}
+
+// closeConnections sends a close frame to every local WebSocket client.
+func (h *Hub) closeConnections(code int, text string) {
+	done := make(chan struct{})
+	h.closing <- closeRequest{code: code, text: text, done: done}
+	<-done
+}
+
+func (h *Hub) Close() error {
+	return h.fanout.Close()
+}
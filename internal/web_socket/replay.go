@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type streamEvent struct {
+	ID   string
+	Data []byte
+}
+
+type replayEntry struct {
+	seq  uint64
+	data []byte
+}
+
+// replayLog keeps the latest frames addressed to one user so a client that
+// reconnects with Last-Event-ID can catch up.
+type replayLog struct {
+	entries []replayEntry
+	next    uint64
+	touched time.Time
+}
+
+func (l *replayLog) append(epoch string, size int, data []byte) streamEvent {
+	l.next++
+	if len(l.entries) > 0 && len(l.entries) >= size {
+		l.entries = l.entries[1:]
+	}
+	l.entries = append(l.entries, replayEntry{seq: l.next, data: data})
+	l.touched = time.Now()
+
+	return streamEvent{ID: formatEventID(epoch, l.next), Data: data}
+}
+
+// since returns the frames after lastEventID. IDs from another hub epoch
+// (a restart or another instance) replay nothing: their sequence numbers say
+// nothing about which of the frames kept here the client has already seen.
+func (l *replayLog) since(epoch, lastEventID string) []streamEvent {
+	if l == nil || lastEventID == "" {
+		return nil
+	}
+
+	eventEpoch, after, ok := parseEventID(lastEventID)
+	if !ok || eventEpoch != epoch {
+		return nil
+	}
+
+	events := make([]streamEvent, 0)
+	for _, entry := range l.entries {
+		if entry.seq > after {
+			events = append(events, streamEvent{ID: formatEventID(epoch, entry.seq), Data: entry.data})
+		}
+	}
+	return events
+}
+
+func formatEventID(epoch string, seq uint64) string {
+	return fmt.Sprintf("%s-%d", epoch, seq)
+}
+
+func parseEventID(id string) (string, uint64, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return id[:i], seq, true
+}
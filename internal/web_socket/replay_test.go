@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplayLog(t *testing.T) {
+	const epoch = "epoch"
+
+	tests := []struct {
+		name        string
+		size        int
+		frames      []string
+		lastEventID string
+		want        []string
+	}{
+		{
+			name:        "replays frames after the last event",
+			size:        10,
+			frames:      []string{"a", "b", "c"},
+			lastEventID: formatEventID(epoch, 1),
+			want:        []string{"b", "c"},
+		},
+		{
+			name:        "client is up to date",
+			size:        10,
+			frames:      []string{"a", "b"},
+			lastEventID: formatEventID(epoch, 2),
+		},
+		{
+			name:        "keeps only the latest frames",
+			size:        2,
+			frames:      []string{"a", "b", "c", "d"},
+			lastEventID: formatEventID(epoch, 0),
+			want:        []string{"c", "d"},
+		},
+		{
+			name:        "zero size keeps the latest frame",
+			size:        0,
+			frames:      []string{"a", "b"},
+			lastEventID: formatEventID(epoch, 0),
+			want:        []string{"b"},
+		},
+		{
+			name:   "no last event id",
+			size:   10,
+			frames: []string{"a"},
+		},
+		{
+			name:        "foreign epoch",
+			size:        10,
+			frames:      []string{"a", "b"},
+			lastEventID: formatEventID("other", 1),
+		},
+		{
+			name:        "malformed event id",
+			size:        10,
+			frames:      []string{"a"},
+			lastEventID: "garbage",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l replayLog
+			for i, frame := range tt.frames {
+				event := l.append(epoch, tt.size, []byte(frame))
+				if want := formatEventID(epoch, uint64(i+1)); event.ID != want {
+					t.Fatalf("append() ID = %q, want %q", event.ID, want)
+				}
+			}
+
+			var got []string
+			for _, event := range l.since(epoch, tt.lastEventID) {
+				got = append(got, string(event.Data))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("since() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayLogSinceNil(t *testing.T) {
+	var l *replayLog
+	if events := l.since("epoch", formatEventID("epoch", 1)); events != nil {
+		t.Errorf("since() on a nil log = %v, want nil", events)
+	}
+}
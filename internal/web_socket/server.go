@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/config"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/cors"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/kafka"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/utils"
+	"github.com/gorilla/websocket"
+)
+
+type Server struct {
+	hub           *Hub
+	transport     kafka.ChatTransport
+	authenticator *jwtauth.Authenticator
+	tickets       *TicketIssuer
+	upgrader      websocket.Upgrader
+	timeout       time.Duration
+	queueDepth    int
+	sessions      *sessionStore
+	inflight      map[string]int
+	drain         *drainState
+	closing       chan struct{}
+	mu            sync.Mutex
+}
+
+func NewServer(cfg *config.Config, hub *Hub, transport kafka.ChatTransport, authenticator *jwtauth.Authenticator, tickets *TicketIssuer, origins *cors.Policy) *Server {
+	drain := &drainState{}
+	return &Server{
+		hub:           hub,
+		transport:     transport,
+		authenticator: authenticator,
+		tickets:       tickets,
+		upgrader:      newUpgrader(origins),
+		timeout:       cfg.ResponseTimeout,
+		queueDepth:    cfg.ChatQueueDepth,
+		sessions:      newSessionStore(cfg.WSSessionTTL, cfg.WSSessionBuffer, cfg.ChatQueueDepth, drain),
+		inflight:      make(map[string]int),
+		drain:         drain,
+		closing:       make(chan struct{}),
+	}
+}
+
+// Shutdown refuses new connections and chat requests, waits for running
+// requests to deliver their replies, then closes WebSocket clients with
+// "going away" and ends SSE streams so clients reconnect elsewhere.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.drain.draining.Store(true)
+	err := s.drain.wait(ctx)
+
+	close(s.closing)
+	s.hub.closeConnections(websocket.CloseGoingAway, "server shutting down")
+	s.sessions.close()
+
+	return err
+}
+
+func (s *Server) ServeWS(w http.ResponseWriter, r *http.Request) {
+	if s.drain.draining.Load() {
+		json.WriteError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+
+	token, err := s.handshakeToken(r)
+	if err != nil {
+		json.WriteError(w, http.StatusUnauthorized, "Authorization required")
+		return
+	}
+
+	identity, err := s.authenticator.Authenticate(token)
+	if err != nil {
+		json.WriteError(w, http.StatusUnauthorized, "Invalid or missing access token")
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Ошибка upgrade WebSocket: %v", err)
+		return
+	}
+
+	session, resumed := s.sessions.resume(r.URL.Query().Get("session_id"), identity.UserID)
+	if !resumed {
+		session = s.sessions.create(identity, s.transport, s.timeout)
+	}
+	lastSeq, _ := strconv.ParseUint(r.URL.Query().Get("last_seq"), 10, 64)
+
+	client := &Client{
+		conn:     conn,
+		identity: identity,
+		session:  session,
+		send:     make(chan []byte, 256+s.sessions.bufferSize),
+	}
+
+	s.hub.register <- client
+
+	go client.writePump()
+	session.attach(client, lastSeq, resumed)
+	go client.readPump(s.hub)
+}
+
+// handshakeToken looks for the access token in the Authorization header, a
+// "bearer.<token>" subprotocol, or a ticket query parameter, in that order.
+func (s *Server) handshakeToken(r *http.Request) (string, error) {
+	if token, err := utils.GetTokenFromHeader(r); err == nil {
+		return token, nil
+	}
+
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, bearerSubprotocol) {
+			return strings.TrimPrefix(protocol, bearerSubprotocol), nil
+		}
+	}
+
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return s.tickets.Redeem(r.Context(), ticket)
+	}
+
+	return "", errors.New("access token is missing")
+}
@@ -0,0 +1,313 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/kafka"
+	"github.com/google/uuid"
+)
+
+type SessionInfo struct {
+	SessionID string `json:"session_id"`
+	Resumed   bool   `json:"resumed"`
+	LastSeq   uint64 `json:"last_seq"`
+}
+
+type sessionFrame struct {
+	seq  uint64
+	data []byte
+}
+
+type chatRequest struct {
+	id     string
+	msg    kafka.RequestMessage
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Session outlives a single connection. Chat requests keep running when the
+// socket drops and their replies are buffered, so a client reconnecting with
+// session_id and last_seq gets the frames it missed.
+type Session struct {
+	id         string
+	userID     string
+	identity   *jwtauth.Identity
+	queue      chan *chatRequest
+	pending    []*chatRequest
+	frames     []sessionFrame
+	seq        uint64
+	bufferSize int
+	client     *Client
+	detachedAt time.Time
+	closed     bool
+	drain      *drainState
+	mu         sync.Mutex
+}
+
+func newSession(identity *jwtauth.Identity, queueDepth, bufferSize int, drain *drainState) *Session {
+	return &Session{
+		id:         uuid.New().String(),
+		userID:     identity.UserID,
+		identity:   identity,
+		drain:      drain,
+		queue:      make(chan *chatRequest, queueDepth),
+		bufferSize: bufferSize,
+		detachedAt: time.Now(),
+	}
+}
+
+// attach binds client to the session and replays the frames after lastSeq.
+func (s *Session) attach(client *Client, lastSeq uint64, resumed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil && s.client != client {
+		s.client.conn.Close()
+	}
+	s.client = client
+	s.identity = client.identity
+
+	client.reply(Envelope{Type: TypeSession, Payload: mustMarshal(SessionInfo{SessionID: s.id, Resumed: resumed, LastSeq: s.seq})})
+	for _, frame := range s.frames {
+		if frame.seq > lastSeq {
+			client.push(frame.data)
+		}
+	}
+}
+
+func (s *Session) detach(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == client {
+		s.client = nil
+		s.detachedAt = time.Now()
+	}
+}
+
+func (s *Session) expired(ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.client == nil && time.Since(s.detachedAt) > ttl
+}
+
+// deliver numbers env, keeps it for replay and forwards it to the attached
+// client, if any.
+func (s *Session) deliver(env Envelope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.seq++
+	env.Version = ProtocolVersion
+	env.Seq = s.seq
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Ошибка сериализации ответа: %v", err)
+		return
+	}
+
+	if len(s.frames) > 0 && len(s.frames) >= s.bufferSize {
+		s.frames = s.frames[1:]
+	}
+	s.frames = append(s.frames, sessionFrame{seq: s.seq, data: data})
+
+	if s.client != nil {
+		s.client.push(data)
+	}
+}
+
+func (s *Session) deliverError(id, code, message string) {
+	s.deliver(Envelope{
+		Type:  TypeError,
+		ID:    id,
+		Error: &EnvelopeError{Code: code, Message: message},
+	})
+}
+
+func (s *Session) enqueue(env Envelope) {
+	if s.drain.draining.Load() {
+		s.deliverError(env.ID, ErrCodeShuttingDown, "server is shutting down")
+		return
+	}
+
+	var requestMsg kafka.RequestMessage
+	if err := json.Unmarshal(env.Payload, &requestMsg); err != nil || requestMsg.Content == "" {
+		s.deliverError(env.ID, ErrCodeInvalidMessage, "invalid chat.send payload")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := &chatRequest{id: env.ID, msg: requestMsg, ctx: ctx, cancel: cancel}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		cancel()
+		return
+	}
+	select {
+	case s.queue <- req:
+		s.pending = append(s.pending, req)
+		s.mu.Unlock()
+	default:
+		s.mu.Unlock()
+		cancel()
+		s.deliverError(env.ID, ErrCodeBusy, "too many requests in progress")
+	}
+}
+
+// worker processes queued chat requests one by one in arrival order.
+func (s *Session) worker(transport kafka.ChatTransport, timeout time.Duration) {
+	for req := range s.queue {
+		switch {
+		case req.ctx.Err() != nil:
+			s.deliverError(req.id, ErrCodeCancelled, "request cancelled")
+		case !s.drain.begin():
+			s.deliverError(req.id, ErrCodeShuttingDown, "server is shutting down")
+		default:
+			s.mu.Lock()
+			req.msg.AuthToken = s.identity.Token
+			s.mu.Unlock()
+			runChat(req.ctx, req.id, req.msg, transport, timeout, s.deliver)
+			s.drain.end()
+		}
+		req.cancel()
+
+		s.mu.Lock()
+		for i, p := range s.pending {
+			if p == req {
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// cancel aborts the queued or in-flight request with the given id. An empty
+// id cancels the request that is currently being processed.
+func (s *Session) cancel(id string) {
+	s.mu.Lock()
+	for _, req := range s.pending {
+		if id == "" || req.id == id {
+			req.cancel()
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	s.deliverError(id, ErrCodeNotFound, "no such request")
+}
+
+func (s *Session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, req := range s.pending {
+		req.cancel()
+	}
+	close(s.queue)
+}
+
+type sessionStore struct {
+	sessions   map[string]*Session
+	ttl        time.Duration
+	bufferSize int
+	queueDepth int
+	drain      *drainState
+	stop       chan struct{}
+	mu         sync.Mutex
+}
+
+func newSessionStore(ttl time.Duration, bufferSize, queueDepth int, drain *drainState) *sessionStore {
+	st := &sessionStore{
+		sessions:   make(map[string]*Session),
+		ttl:        ttl,
+		bufferSize: bufferSize,
+		queueDepth: queueDepth,
+		drain:      drain,
+		stop:       make(chan struct{}),
+	}
+	go st.expire()
+
+	return st
+}
+
+// resume returns the session with the given id if it belongs to userID. The
+// owner is read from the immutable userID, since attach replaces identity
+// under the session's own lock.
+func (st *sessionStore) resume(id, userID string) (*Session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	session, ok := st.sessions[id]
+	if !ok || session.userID != userID {
+		return nil, false
+	}
+	return session, true
+}
+
+func (st *sessionStore) create(identity *jwtauth.Identity, transport kafka.ChatTransport, timeout time.Duration) *Session {
+	session := newSession(identity, st.queueDepth, st.bufferSize, st.drain)
+	go session.worker(transport, timeout)
+
+	st.mu.Lock()
+	st.sessions[session.id] = session
+	st.mu.Unlock()
+
+	return session
+}
+
+func (st *sessionStore) expire() {
+	ticker := time.NewTicker(st.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-st.stop:
+			return
+		}
+
+		st.mu.Lock()
+		for id, session := range st.sessions {
+			if session.expired(st.ttl) {
+				session.close()
+				delete(st.sessions, id)
+			}
+		}
+		st.mu.Unlock()
+	}
+}
+
+func (st *sessionStore) close() {
+	close(st.stop)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for id, session := range st.sessions {
+		session.close()
+		delete(st.sessions, id)
+	}
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
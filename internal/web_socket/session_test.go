@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+)
+
+func TestSessionDeliver(t *testing.T) {
+	tests := []struct {
+		name       string
+		bufferSize int
+		delivered  int
+		lastSeq    uint64
+		wantKept   []uint64
+		wantReplay []uint64
+	}{
+		{
+			name:       "replays frames after last_seq",
+			bufferSize: 10,
+			delivered:  3,
+			lastSeq:    1,
+			wantKept:   []uint64{1, 2, 3},
+			wantReplay: []uint64{2, 3},
+		},
+		{
+			name:       "keeps only the latest frames",
+			bufferSize: 2,
+			delivered:  5,
+			wantKept:   []uint64{4, 5},
+			wantReplay: []uint64{4, 5},
+		},
+		{
+			name:       "zero buffer keeps the latest frame",
+			bufferSize: 0,
+			delivered:  2,
+			wantKept:   []uint64{2},
+			wantReplay: []uint64{2},
+		},
+		{
+			name:       "client is up to date",
+			bufferSize: 10,
+			delivered:  2,
+			lastSeq:    2,
+			wantKept:   []uint64{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := &jwtauth.Identity{UserID: "user-1"}
+			session := newSession(identity, 1, tt.bufferSize, &drainState{})
+			for i := 0; i < tt.delivered; i++ {
+				session.deliver(Envelope{Type: TypeChatChunk})
+			}
+
+			var kept []uint64
+			for _, frame := range session.frames {
+				kept = append(kept, frame.seq)
+			}
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept frames %v, want %v", kept, tt.wantKept)
+			}
+
+			client := &Client{identity: identity, send: make(chan []byte, tt.delivered+1)}
+			session.attach(client, tt.lastSeq, true)
+			close(client.send)
+
+			var info Envelope
+			if err := json.Unmarshal(<-client.send, &info); err != nil || info.Type != TypeSession {
+				t.Fatalf("first frame = %+v (%v), want a session frame", info, err)
+			}
+			var replayed []uint64
+			for data := range client.send {
+				var env Envelope
+				if err := json.Unmarshal(data, &env); err != nil {
+					t.Fatalf("replayed frame is not an envelope: %v", err)
+				}
+				replayed = append(replayed, env.Seq)
+			}
+			if !reflect.DeepEqual(replayed, tt.wantReplay) {
+				t.Errorf("replayed frames %v, want %v", replayed, tt.wantReplay)
+			}
+		})
+	}
+}
+
+func TestSessionStoreResume(t *testing.T) {
+	st := newSessionStore(time.Minute, 10, 1, &drainState{})
+	defer st.close()
+
+	session := st.create(&jwtauth.Identity{UserID: "user-1"}, nil, time.Second)
+
+	tests := []struct {
+		name   string
+		id     string
+		userID string
+		want   bool
+	}{
+		{name: "owner", id: session.id, userID: "user-1", want: true},
+		{name: "another user", id: session.id, userID: "user-2"},
+		{name: "unknown session", id: "missing", userID: "user-1"},
+		{name: "no session id", userID: "user-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := st.resume(tt.id, tt.userID)
+			if ok != tt.want {
+				t.Fatalf("resume() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && got != session {
+				t.Errorf("resume() returned another session")
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	common "github.com/GP-Hacks/kdt2024-commons/json"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/jwtauth"
+	"github.com/GP-Hacks/kdt2024-gateway/internal/kafka"
+	"github.com/google/uuid"
+)
+
+const sseHeartbeat = 15 * time.Second
+
+type SendChatRequest struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+// ServeSSE streams chat replies and push events to browsers that cannot use
+// WebSockets. Frames are the same envelopes, with the envelope type as the
+// SSE event name. Authentication works as for the WebSocket handshake.
+func (s *Server) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	if s.drain.draining.Load() {
+		common.WriteError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+
+	token, err := s.handshakeToken(r)
+	if err != nil {
+		common.WriteError(w, http.StatusUnauthorized, "Authorization required")
+		return
+	}
+
+	identity, err := s.authenticator.Authenticate(token)
+	if err != nil {
+		common.WriteError(w, http.StatusUnauthorized, "Invalid or missing access token")
+		return
+	}
+
+	// The server write timeout is meant for regular requests, not streams.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		common.WriteError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	stream := &sseStream{
+		userID:      identity.UserID,
+		lastEventID: lastEventID,
+		events:      make(chan streamEvent, 256),
+		overflow:    make(chan struct{}),
+	}
+	s.hub.attach <- stream
+	defer func() {
+		s.hub.detach <- stream
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	rc.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	var expired <-chan time.Time
+	if !identity.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(identity.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	ctx := r.Context()
+	for {
+		select {
+		case event := <-stream.events:
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-stream.overflow:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-expired:
+			data, _ := json.Marshal(Envelope{
+				Version: ProtocolVersion,
+				Type:    TypeError,
+				Error:   &EnvelopeError{Code: ErrCodeTokenExpired, Message: "token expired"},
+			})
+			writeSSE(w, streamEvent{Data: data})
+			rc.Flush()
+			return
+		case <-s.closing:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event streamEvent) error {
+	var env struct {
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(event.Data, &env)
+
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	if env.Type != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", env.Type); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", event.Data)
+	return err
+}
+
+// SendChat accepts a chat message whose replies are delivered to the user's
+// SSE streams, tagged with the returned request ID.
+func (s *Server) SendChat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	select {
+	case <-ctx.Done():
+		http.Error(w, "Request was cancelled", http.StatusRequestTimeout)
+		return
+	default:
+	}
+
+	identity, ok := jwtauth.FromContext(ctx)
+	if !ok {
+		common.WriteError(w, http.StatusUnauthorized, "Authorization required")
+		return
+	}
+
+	var request SendChatRequest
+	if err := common.ReadJSON(r, &request); err != nil || request.Content == "" {
+		common.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if request.ID == "" {
+		request.ID = uuid.New().String()
+	}
+
+	if !s.acquire(identity.UserID) {
+		common.WriteError(w, http.StatusTooManyRequests, "Too many requests in progress")
+		return
+	}
+	if !s.drain.begin() {
+		s.release(identity.UserID)
+		common.WriteError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+
+	go func() {
+		defer s.release(identity.UserID)
+		defer s.drain.end()
+
+		requestMsg := kafka.RequestMessage{AuthToken: identity.Token, Content: request.Content}
+		runChat(context.Background(), request.ID, requestMsg, s.transport, s.timeout, func(env Envelope) {
+			s.hub.sendToStreams(identity.UserID, env)
+		})
+	}()
+
+	common.WriteJSON(w, http.StatusAccepted, map[string]string{"id": request.ID})
+}
+
+func (s *Server) acquire(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inflight[userID] >= s.queueDepth {
+		return false
+	}
+	s.inflight[userID]++
+	return true
+}
+
+func (s *Server) release(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inflight[userID]--; s.inflight[userID] <= 0 {
+		delete(s.inflight, userID)
+	}
+}
@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrInvalidTicket = errors.New("invalid or expired websocket ticket")
+
+// TicketIssuer hands out short-lived tickets that browsers can pass in the
+// WebSocket URL instead of the access token. The access token is sealed with
+// AES-GCM, so the ticket can be redeemed by any replica sharing the secret.
+// A ticket is single-use for as far as its TicketStore is shared.
+type TicketIssuer struct {
+	aead  cipher.AEAD
+	ttl   time.Duration
+	store TicketStore
+}
+
+// TicketStore remembers the nonces of redeemed tickets until they expire.
+type TicketStore interface {
+	// Claim records nonce and reports whether it was not recorded before.
+	Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+	Close() error
+}
+
+// MemoryTicketStore remembers nonces in process. With WS_TICKET_SECRET shared
+// between replicas, a ticket can still be redeemed once on each replica
+// within its TTL; use RedisTicketStore for more than one replica.
+type MemoryTicketStore struct {
+	redeemed map[string]time.Time
+	mu       sync.Mutex
+}
+
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{redeemed: make(map[string]time.Time)}
+}
+
+func (s *MemoryTicketStore) Claim(_ context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for used, usedExpiresAt := range s.redeemed {
+		if now.After(usedExpiresAt) {
+			delete(s.redeemed, used)
+		}
+	}
+	if _, used := s.redeemed[nonce]; used {
+		return false, nil
+	}
+	s.redeemed[nonce] = expiresAt
+	return true, nil
+}
+
+func (s *MemoryTicketStore) Close() error {
+	return nil
+}
+
+type ticketClaims struct {
+	Token     string `json:"t"`
+	ExpiresAt int64  `json:"e"`
+}
+
+func NewTicketIssuer(secret string, ttl time.Duration, store TicketStore) (*TicketIssuer, error) {
+	var key [32]byte
+	if secret == "" {
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, fmt.Errorf("failed to generate ticket key: %w", err)
+		}
+	} else {
+		key = sha256.Sum256([]byte(secret))
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TicketIssuer{aead: aead, ttl: ttl, store: store}, nil
+}
+
+func (t *TicketIssuer) Issue(accessToken string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(t.ttl)
+	plain, err := json.Marshal(ticketClaims{Token: accessToken, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	nonce := make([]byte, t.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, err
+	}
+
+	sealed := t.aead.Seal(nonce, nonce, plain, nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), expiresAt, nil
+}
+
+func (t *TicketIssuer) Redeem(ctx context.Context, ticket string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(ticket)
+	if err != nil || len(sealed) < t.aead.NonceSize() {
+		return "", ErrInvalidTicket
+	}
+
+	nonce, ciphertext := sealed[:t.aead.NonceSize()], sealed[t.aead.NonceSize():]
+	plain, err := t.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrInvalidTicket
+	}
+
+	var claims ticketClaims
+	if err := json.Unmarshal(plain, &claims); err != nil {
+		return "", ErrInvalidTicket
+	}
+	// Expiry has second precision, so the ticket stays valid until the end
+	// of its last second.
+	expiresAt := time.Unix(claims.ExpiresAt+1, 0)
+	if !time.Now().Before(expiresAt) {
+		return "", ErrInvalidTicket
+	}
+
+	unused, err := t.store.Claim(ctx, base64.RawURLEncoding.EncodeToString(nonce), expiresAt)
+	if err != nil {
+		return "", fmt.Errorf("failed to record websocket ticket: %w", err)
+	}
+	if !unused {
+		return "", ErrInvalidTicket
+	}
+
+	return claims.Token, nil
+}
+
+func (t *TicketIssuer) Close() error {
+	return t.store.Close()
+}
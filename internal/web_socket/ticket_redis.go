@@ -0,0 +1,31 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTicketStore shares redeemed nonces between replicas, so a ticket is
+// single-use across the whole deployment.
+type RedisTicketStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisTicketStore(client *redis.Client, prefix string) *RedisTicketStore {
+	return &RedisTicketStore{client: client, prefix: prefix}
+}
+
+func (s *RedisTicketStore) Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return s.client.SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+}
+
+func (s *RedisTicketStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTicketIssuerRedeem(t *testing.T) {
+	store := NewMemoryTicketStore()
+	newIssuer := func(secret string, ttl time.Duration, store TicketStore) *TicketIssuer {
+		issuer, err := NewTicketIssuer(secret, ttl, store)
+		if err != nil {
+			t.Fatalf("NewTicketIssuer() error = %v", err)
+		}
+		return issuer
+	}
+	issuer := newIssuer("secret", time.Minute, store)
+	replica := newIssuer("secret", time.Minute, store)
+	other := newIssuer("other-secret", time.Minute, NewMemoryTicketStore())
+	expired := newIssuer("secret", -2*time.Second, NewMemoryTicketStore())
+	ctx := context.Background()
+
+	issue := func(t *testing.T, issuer *TicketIssuer) string {
+		ticket, _, err := issuer.Issue("access-token")
+		if err != nil {
+			t.Fatalf("Issue() error = %v", err)
+		}
+		return ticket
+	}
+
+	tests := []struct {
+		name    string
+		ticket  func(t *testing.T) string
+		wantErr error
+	}{
+		{
+			name:   "valid ticket",
+			ticket: func(t *testing.T) string { return issue(t, issuer) },
+		},
+		{
+			name: "ticket redeemed twice",
+			ticket: func(t *testing.T) string {
+				ticket := issue(t, issuer)
+				if _, err := issuer.Redeem(ctx, ticket); err != nil {
+					t.Fatalf("first Redeem() error = %v", err)
+				}
+				return ticket
+			},
+			wantErr: ErrInvalidTicket,
+		},
+		{
+			name: "ticket redeemed on another replica",
+			ticket: func(t *testing.T) string {
+				ticket := issue(t, issuer)
+				if _, err := replica.Redeem(ctx, ticket); err != nil {
+					t.Fatalf("first Redeem() error = %v", err)
+				}
+				return ticket
+			},
+			wantErr: ErrInvalidTicket,
+		},
+		{
+			name:    "expired ticket",
+			ticket:  func(t *testing.T) string { return issue(t, expired) },
+			wantErr: ErrInvalidTicket,
+		},
+		{
+			name:    "ticket sealed with another secret",
+			ticket:  func(t *testing.T) string { return issue(t, other) },
+			wantErr: ErrInvalidTicket,
+		},
+		{
+			name: "tampered ticket",
+			ticket: func(t *testing.T) string {
+				ticket := []byte(issue(t, issuer))
+				i := len(ticket) / 2
+				if ticket[i] == 'A' {
+					ticket[i] = 'B'
+				} else {
+					ticket[i] = 'A'
+				}
+				return string(ticket)
+			},
+			wantErr: ErrInvalidTicket,
+		},
+		{
+			name:    "not base64",
+			ticket:  func(*testing.T) string { return "not a ticket!" },
+			wantErr: ErrInvalidTicket,
+		},
+		{
+			name:    "shorter than a nonce",
+			ticket:  func(*testing.T) string { return "AAAA" },
+			wantErr: ErrInvalidTicket,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := issuer.Redeem(ctx, tt.ticket(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Redeem() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && token != "access-token" {
+				t.Errorf("Redeem() = %q, want %q", token, "access-token")
+			}
+		})
+	}
+}
@@ -2,12 +2,30 @@ package websocket
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/GP-Hacks/kdt2024-gateway/internal/http-server/middleware/cors"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+const (
+	chatSubprotocol   = "chat.v1"
+	bearerSubprotocol = "bearer."
+)
+
+// newUpgrader accepts requests without an Origin header (mobile apps), from
+// the gateway's own host, and from origins allowed by the CORS policy.
+func newUpgrader(origins *cors.Policy) websocket.Upgrader {
+	return websocket.Upgrader{
+		Subprotocols: []string{chatSubprotocol},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || origins.AllowOrigin(origin) {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		},
+	}
 }